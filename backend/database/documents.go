@@ -0,0 +1,157 @@
+package database
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Document is a file indexed for retrieval in a session.
+type Document struct {
+	ID             string    `json:"id"`
+	SessionID      string    `json:"session_id"`
+	FileName       string    `json:"file_name"`
+	FileType       string    `json:"file_type"`
+	Pages          int       `json:"pages"`
+	EmbeddingModel string    `json:"embedding_model"`
+	ChunkCount     int       `json:"chunk_count"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type DocumentChunk struct {
+	ID             int64     `json:"id"`
+	DocumentID     string    `json:"document_id"`
+	SessionID      string    `json:"session_id"`
+	Index          int       `json:"index"`
+	Page           int       `json:"page"`
+	Content        string    `json:"content"`
+	Embedding      []float32 `json:"-"`
+	FileName       string    `json:"file_name"`
+	EmbeddingModel string    `json:"-"`
+}
+
+func encodeEmbedding(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return v
+}
+
+// SaveDocument stores a document and its chunks in one transaction.
+func SaveDocument(d Document, chunks []DocumentChunk) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertDocument(tx, d, chunks); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertDocument(db execer, d Document, chunks []DocumentChunk) error {
+	_, err := db.Exec(`
+		INSERT INTO documents (id, session_id, file_name, file_type, pages, embedding_model, chunk_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, d.ID, d.SessionID, d.FileName, d.FileType, d.Pages, d.EmbeddingModel, len(chunks), d.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		_, err = db.Exec(`
+			INSERT INTO document_chunks (document_id, session_id, chunk_index, page, content, embedding)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, d.ID, d.SessionID, c.Index, c.Page, c.Content, encodeEmbedding(c.Embedding))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetDocument(sessionID, id string) (*Document, error) {
+	var d Document
+	err := DB.QueryRow(`
+		SELECT id, session_id, file_name, file_type, pages, embedding_model, chunk_count, created_at
+		FROM documents WHERE id = ? AND session_id = ?
+	`, id, sessionID).Scan(&d.ID, &d.SessionID, &d.FileName, &d.FileType, &d.Pages, &d.EmbeddingModel, &d.ChunkCount, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func ListDocuments(sessionID string) ([]Document, error) {
+	rows, err := DB.Query(`
+		SELECT id, session_id, file_name, file_type, pages, embedding_model, chunk_count, created_at
+		FROM documents WHERE session_id = ? ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var documents []Document
+	for rows.Next() {
+		var d Document
+		if err := rows.Scan(&d.ID, &d.SessionID, &d.FileName, &d.FileType, &d.Pages, &d.EmbeddingModel, &d.ChunkCount, &d.CreatedAt); err != nil {
+			continue
+		}
+		documents = append(documents, d)
+	}
+	return documents, nil
+}
+
+// ListSessionChunks loads every chunk of a session with its embedding.
+func ListSessionChunks(sessionID string) ([]DocumentChunk, error) {
+	rows, err := DB.Query(`
+		SELECT c.id, c.document_id, c.session_id, c.chunk_index, c.page, c.content, c.embedding, d.file_name, d.embedding_model
+		FROM document_chunks c
+		JOIN documents d ON d.id = c.document_id
+		WHERE c.session_id = ?
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []DocumentChunk
+	for rows.Next() {
+		var c DocumentChunk
+		var embedding []byte
+		if err := rows.Scan(&c.ID, &c.DocumentID, &c.SessionID, &c.Index, &c.Page, &c.Content, &embedding, &c.FileName, &c.EmbeddingModel); err != nil {
+			continue
+		}
+		c.Embedding = decodeEmbedding(embedding)
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
+}
+
+func DeleteDocument(id string) error {
+	if _, err := DB.Exec(`DELETE FROM document_chunks WHERE document_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := DB.Exec(`DELETE FROM documents WHERE id = ?`, id)
+	return err
+}
+
+func DeleteSessionDocuments(sessionID string) error {
+	if _, err := DB.Exec(`DELETE FROM document_chunks WHERE session_id = ?`, sessionID); err != nil {
+		return err
+	}
+	_, err := DB.Exec(`DELETE FROM documents WHERE session_id = ?`, sessionID)
+	return err
+}
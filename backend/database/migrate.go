@@ -0,0 +1,233 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are SQL files named NNNN_description.sql and applied in
+// version order. Applied migrations must never be edited; change the schema
+// by adding a new file.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: name must start with a positive version number", entry.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, name, version)
+		}
+		seen[version] = name
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{Version: version, Name: name, SQL: string(content)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func SchemaVersion() (int, error) {
+	var version int
+	err := DB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// migrate applies the embedded migrations the database hasn't seen yet, each
+// in its own transaction. It refuses to touch a database whose schema is
+// newer than this build knows about.
+func migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	latest := 0
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	versioned, err := tableExists("schema_migrations")
+	if err != nil {
+		return err
+	}
+	if !versioned {
+		if err := upgradeUnversioned(); err != nil {
+			return fmt.Errorf("failed to upgrade unversioned database: %w", err)
+		}
+	}
+
+	_, err = DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	current, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade LocalAI or use a different database", current, latest)
+	}
+
+	applied := make(map[int]bool)
+	rows, err := DB.Query(`SELECT version FROM schema_migrations`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.Name, err)
+		}
+		log.Printf("Applied migration %s", m.Name)
+	}
+	return nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgradeUnversioned brings tables created before versioned migrations up to
+// the initial migration's schema, since CREATE TABLE IF NOT EXISTS leaves
+// existing tables untouched. Tables that don't exist yet are created in full
+// by the migration.
+func upgradeUnversioned() error {
+	columns := []struct{ table, name, definition string }{
+		{"messages", "attachments", "TEXT"},
+		{"messages", "pinned", "INTEGER DEFAULT 0"},
+		{"messages", "kind", "TEXT DEFAULT ''"},
+		{"messages", "routing", "TEXT"},
+		{"sessions", "active_leaf_id", "TEXT"},
+		{"sessions", "turn_taking", "TEXT DEFAULT ''"},
+		{"sessions", "workflow", "TEXT DEFAULT ''"},
+		{"sessions", "debate", "TEXT DEFAULT ''"},
+		{"sessions", "parallel_responses", "INTEGER DEFAULT 0"},
+		{"sessions", "router", "TEXT DEFAULT ''"},
+		{"attachments", "sha256", "TEXT"},
+		{"attachments", "pages", "INTEGER DEFAULT 0"},
+		{"attachments", "content", "TEXT"},
+		{"attachments", "structure", "TEXT"},
+	}
+	for _, column := range columns {
+		if _, err := addColumnIfMissing(column.table, column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	added, err := addColumnIfMissing("messages", "parent_id", "TEXT")
+	if err != nil {
+		return err
+	}
+	if added {
+		// Existing conversations were linear, so chain each message to the one before it
+		_, err = DB.Exec(`
+			UPDATE messages SET parent_id = (
+				SELECT prev.id FROM messages prev
+				WHERE prev.session_id = messages.session_id AND prev.created_at < messages.created_at
+				ORDER BY prev.created_at DESC LIMIT 1
+			)
+		`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tableExists(table string) (bool, error) {
+	var exists bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`, table).Scan(&exists)
+	return exists, err
+}
+
+// addColumnIfMissing adds a column to an existing table and reports whether
+// it was added. Missing tables are left alone.
+func addColumnIfMissing(table, column, definition string) (bool, error) {
+	exists, err := tableExists(table)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err == nil, err
+}
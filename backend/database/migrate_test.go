@@ -0,0 +1,136 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+// baselineSchema is the schema databases had before versioned migrations.
+const baselineSchema = `
+CREATE TABLE sessions (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	model_configs TEXT NOT NULL,
+	autonomy_rounds INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE messages (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	model_id TEXT,
+	model_name TEXT,
+	content TEXT NOT NULL,
+	round_number INTEGER DEFAULT 0,
+	tokens_used INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE provider_keys (
+	provider TEXT PRIMARY KEY,
+	api_key TEXT NOT NULL,
+	enabled INTEGER DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO sessions (id, name, model_configs) VALUES ('s1', 'Fruit planning', '[]');
+INSERT INTO messages (id, session_id, role, content, created_at) VALUES
+	('m1', 's1', 'user', 'Should we buy bananas?', '2024-01-01 10:00:00'),
+	('m2', 's1', 'assistant', 'Yes, bananas are cheap.', '2024-01-01 10:00:05'),
+	('m3', 's1', 'user', 'And apples?', '2024-01-01 10:00:10');
+`
+
+func latestMigration(t *testing.T) int {
+	t.Helper()
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	openTestDB(t)
+	if _, err := DB.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if version, err := SchemaVersion(); err != nil || version != latestMigration(t) {
+		t.Errorf("schema version = %d (%v), want %d", version, err, latestMigration(t))
+	}
+
+	// Added columns are usable and the linear history is chained
+	wantParents := map[string]string{"m1": "", "m2": "m1", "m3": "m2"}
+	for id, want := range wantParents {
+		m, err := GetMessage("s1", id)
+		if err != nil {
+			t.Fatalf("GetMessage(%s): %v", id, err)
+		}
+		got := ""
+		if m.ParentID != nil {
+			got = *m.ParentID
+		}
+		if got != want {
+			t.Errorf("%s parent = %q, want %q", id, got, want)
+		}
+	}
+	if branch, err := ListBranch("s1"); err != nil || len(branch) != 3 {
+		t.Errorf("branch has %d messages (%v), want 3", len(branch), err)
+	}
+
+	// Rows written before search existed are backfilled into the FTS tables
+	hits, err := SearchMessages(SearchOptions{Query: "banana", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	if len(hits) != 2 {
+		t.Errorf("found %d messages for banana, want 2", len(hits))
+	}
+	sessions, err := SearchSessions(SearchOptions{Query: "fruit", Limit: 10})
+	if err != nil || len(sessions) != 1 {
+		t.Errorf("found %d sessions for fruit (%v), want 1", len(sessions), err)
+	}
+
+	// Running again applies nothing and indexes nothing twice
+	if err := migrate(); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	var indexed int
+	DB.QueryRow(`SELECT COUNT(*) FROM messages_fts`).Scan(&indexed)
+	if indexed != 3 {
+		t.Errorf("messages_fts has %d rows, want 3", indexed)
+	}
+}
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	openTestDB(t)
+	if err := migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if version, err := SchemaVersion(); err != nil || version != latestMigration(t) {
+		t.Errorf("schema version = %d (%v), want %d", version, err, latestMigration(t))
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	openTestDB(t)
+	if err := migrate(); err != nil {
+		t.Fatal(err)
+	}
+	newer := latestMigration(t) + 1
+	if _, err := DB.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, 'from_the_future')`, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	err := migrate()
+	if err == nil || !strings.Contains(err.Error(), "newer than this build supports") {
+		t.Errorf("migrate() = %v, want a newer-schema error", err)
+	}
+}
@@ -0,0 +1,175 @@
+-- Schema as of the introduction of versioned migrations. Every statement is
+-- idempotent so databases created by earlier builds can adopt it; their
+-- existing tables are brought up to date by upgradeUnversioned first.
+
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	model_configs TEXT NOT NULL,
+	autonomy_rounds INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	active_leaf_id TEXT,
+	turn_taking TEXT DEFAULT '',
+	workflow TEXT DEFAULT '',
+	debate TEXT DEFAULT '',
+	parallel_responses INTEGER DEFAULT 0,
+	router TEXT DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS messages (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	role TEXT NOT NULL,
+	model_id TEXT,
+	model_name TEXT,
+	content TEXT NOT NULL,
+	round_number INTEGER DEFAULT 0,
+	tokens_used INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	attachments TEXT,
+	pinned INTEGER DEFAULT 0,
+	kind TEXT DEFAULT '',
+	routing TEXT,
+	parent_id TEXT,
+	FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS provider_keys (
+	provider TEXT PRIMARY KEY,
+	api_key TEXT NOT NULL,
+	enabled INTEGER DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+	id TEXT PRIMARY KEY,
+	session_id TEXT,
+	file_name TEXT NOT NULL,
+	mime_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	path TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	sha256 TEXT,
+	pages INTEGER DEFAULT 0,
+	content TEXT,
+	structure TEXT
+);
+
+CREATE TABLE IF NOT EXISTS session_templates (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT DEFAULT '',
+	model_configs TEXT NOT NULL,
+	autonomy_rounds INTEGER DEFAULT 0,
+	turn_taking TEXT DEFAULT '',
+	workflow TEXT DEFAULT '',
+	debate TEXT DEFAULT '',
+	parallel_responses INTEGER DEFAULT 0,
+	router TEXT DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT DEFAULT '',
+	keywords TEXT DEFAULT '[]',
+	system_prompt TEXT DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS personas (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	prompt TEXT DEFAULT '',
+	role TEXT DEFAULT '',
+	params TEXT DEFAULT '{}',
+	color TEXT DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS custom_providers (
+	name TEXT PRIMARY KEY,
+	base_url TEXT NOT NULL,
+	api_key TEXT DEFAULT '',
+	headers TEXT DEFAULT '{}',
+	models TEXT DEFAULT '[]',
+	auto_discover INTEGER DEFAULT 0,
+	enabled INTEGER DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS documents (
+	id TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	file_name TEXT NOT NULL,
+	file_type TEXT DEFAULT '',
+	pages INTEGER DEFAULT 0,
+	embedding_model TEXT NOT NULL,
+	chunk_count INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS document_chunks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id TEXT NOT NULL,
+	session_id TEXT NOT NULL,
+	chunk_index INTEGER NOT NULL,
+	page INTEGER DEFAULT 0,
+	content TEXT NOT NULL,
+	embedding BLOB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_chunks_session ON document_chunks(session_id);
+
+-- Full-text search over message content and session names, kept in sync
+-- through triggers so every code path that writes rows is covered.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+	content,
+	message_id UNINDEXED,
+	tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_insert AFTER INSERT ON messages BEGIN
+	INSERT INTO messages_fts (content, message_id) VALUES (new.content, new.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_update AFTER UPDATE OF content ON messages BEGIN
+	DELETE FROM messages_fts WHERE message_id = old.id;
+	INSERT INTO messages_fts (content, message_id) VALUES (new.content, new.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS messages_fts_delete AFTER DELETE ON messages BEGIN
+	DELETE FROM messages_fts WHERE message_id = old.id;
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS sessions_fts USING fts5(
+	name,
+	session_id UNINDEXED,
+	tokenize = 'porter unicode61'
+);
+
+CREATE TRIGGER IF NOT EXISTS sessions_fts_insert AFTER INSERT ON sessions BEGIN
+	INSERT INTO sessions_fts (name, session_id) VALUES (new.name, new.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS sessions_fts_update AFTER UPDATE OF name ON sessions BEGIN
+	DELETE FROM sessions_fts WHERE session_id = old.id;
+	INSERT INTO sessions_fts (name, session_id) VALUES (new.name, new.id);
+END;
+
+CREATE TRIGGER IF NOT EXISTS sessions_fts_delete AFTER DELETE ON sessions BEGIN
+	DELETE FROM sessions_fts WHERE session_id = old.id;
+END;
+
+-- Index rows written before search existed
+INSERT INTO messages_fts (content, message_id)
+	SELECT content, id FROM messages WHERE id NOT IN (SELECT message_id FROM messages_fts);
+INSERT INTO sessions_fts (name, session_id)
+	SELECT name, id FROM sessions WHERE id NOT IN (SELECT session_id FROM sessions_fts);
@@ -1,12 +1,21 @@
 package database
 
-import "time"
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
 
 type Session struct {
 	ID            string    `json:"id"`
 	Name          string    `json:"name"`
 	ModelConfigs  string    `json:"model_configs"`
 	AutonomyRounds int      `json:"autonomy_rounds"`
+	TurnTaking    string    `json:"turn_taking"`
+	Workflow      string    `json:"workflow"`
+	Debate        string    `json:"debate"`
+	ParallelResponses bool  `json:"parallel_responses"`
+	Router        string    `json:"router"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -14,22 +23,212 @@ type Session struct {
 type Message struct {
 	ID          string    `json:"id"`
 	SessionID   string    `json:"session_id"`
+	ParentID    *string   `json:"parent_id"`
 	Role        string    `json:"role"`
 	ModelID     *string   `json:"model_id"`
 	ModelName   *string   `json:"model_name"`
 	Content     string    `json:"content"`
 	RoundNumber int       `json:"round_number"`
 	TokensUsed  int       `json:"tokens_used"`
+	Attachments []string  `json:"attachments,omitempty"`
+	Pinned      bool      `json:"pinned,omitempty"`
+	Kind        string    `json:"kind,omitempty"`
+	Routing     *RoutingDecision `json:"routing,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Message kinds written by debates; ordinary messages have none.
+const (
+	MessageKindAnswer   = "answer"
+	MessageKindCritique = "critique"
+	MessageKindVote     = "vote"
+	MessageKindFinal    = "final"
+)
+
+type Attachment struct {
+	ID        string    `json:"id"`
+	SessionID *string   `json:"session_id"`
+	FileName  string    `json:"file_name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256,omitempty"`
+	Pages     int       `json:"pages,omitempty"`
+	Content   string    `json:"-"` // extracted text of document attachments
+	Structure string    `json:"-"` // JSON page structure, for formats that have one
+	Path      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type ModelConfig struct {
-	ModelID      string `json:"model_id"`
-	Name         string `json:"name"`
-	ShortID      string `json:"short_id"`
-	SystemPrompt string `json:"system_prompt"`
-	Color        string `json:"color"`
-	Role         string `json:"role"`
+	ModelID        string           `json:"model_id"`
+	Name           string           `json:"name"`
+	ShortID        string           `json:"short_id"`
+	PersonaID      string           `json:"persona_id,omitempty"`
+	SystemPrompt   string           `json:"system_prompt"`
+	Color          string           `json:"color"`
+	Role           string           `json:"role"`
+	Params         GenerationParams `json:"params"`
+	Tools          []string         `json:"tools,omitempty"`
+	FallbackModels []string         `json:"fallback_models,omitempty"`
+	Retry          *RetryConfig     `json:"retry,omitempty"`
+	Context        *ContextConfig   `json:"context,omitempty"`
+}
+
+// RetryConfig overrides the default retry policy for a model.
+type RetryConfig struct {
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	BaseDelayMs int `json:"base_delay_ms,omitempty"`
+	MaxDelayMs  int `json:"max_delay_ms,omitempty"`
+}
+
+// ContextConfig controls how history is compacted once it no longer fits the
+// model's context window. Pinned messages are always kept.
+type ContextConfig struct {
+	Strategy        string `json:"strategy,omitempty"`
+	SummarizerModel string `json:"summarizer_model,omitempty"`
+}
+
+const (
+	CompactionDropOldest = "drop_oldest"
+	CompactionSummarize  = "summarize"
+)
+
+// TurnTakingConfig controls who speaks during autonomy rounds. In moderator
+// mode ModeratorModel picks each next speaker; without one a heuristic does.
+type TurnTakingConfig struct {
+	Mode           string `json:"mode,omitempty"`
+	ModeratorModel string `json:"moderator_model,omitempty"`
+}
+
+const (
+	TurnTakingRoundRobin = "round_robin"
+	TurnTakingModerator  = "moderator"
+)
+
+// ParseTurnTaking decodes a session's turn_taking column, defaulting to
+// round robin.
+func ParseTurnTaking(raw string) TurnTakingConfig {
+	var t TurnTakingConfig
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &t)
+	}
+	if t.Mode == "" {
+		t.Mode = TurnTakingRoundRobin
+	}
+	return t
+}
+
+// RouterConfig chooses how messages that mention nobody are routed to
+// responders. In model mode Model classifies each message, and decisions
+// below MinConfidence fall back to keyword routing.
+type RouterConfig struct {
+	Mode          string  `json:"mode,omitempty"`
+	Model         string  `json:"model,omitempty"`
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+}
+
+const (
+	RouterKeyword = "keyword"
+	RouterModel   = "model"
+)
+
+// ParseRouter decodes a session's router column, defaulting to keyword
+// routing.
+func ParseRouter(raw string) RouterConfig {
+	var r RouterConfig
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &r)
+	}
+	if r.Mode == "" {
+		r.Mode = RouterKeyword
+	}
+	return r
+}
+
+// RoutingDecision records why a user message went to its responders.
+// Fallback is set when the configured router failed or was not confident
+// enough and keyword routing decided instead.
+type RoutingDecision struct {
+	Router     string   `json:"router"`
+	Roles      []string `json:"roles,omitempty"`
+	Responders []string `json:"responders"`
+	Confidence float64  `json:"confidence"`
+	Reason     string   `json:"reason,omitempty"`
+	Fallback   bool     `json:"fallback,omitempty"`
+}
+
+// GenerationParams are optional sampling settings for a model. Zero values
+// (or nil pointers) leave the provider's default in place.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+	ContextSize int      `json:"context_size,omitempty"`
+}
+
+// Workflow is a pipeline of stages that answers each user message in place
+// of the usual discussion. Without any DependsOn the stages run in order;
+// otherwise DependsOn forms a DAG and stages without it start first.
+type Workflow struct {
+	Stages []WorkflowStage `json:"stages"`
+}
+
+// WorkflowStage runs one model, picked by ShortID or else by Role. Prompt
+// may reference {{input}}, {{iteration}} and earlier outputs as {{stage_id}}.
+type WorkflowStage struct {
+	ID        string        `json:"id"`
+	Role      string        `json:"role,omitempty"`
+	ShortID   string        `json:"short_id,omitempty"`
+	Prompt    string        `json:"prompt,omitempty"`
+	DependsOn []string      `json:"depends_on,omitempty"`
+	Loop      *WorkflowLoop `json:"loop,omitempty"`
+}
+
+// WorkflowLoop sends a workflow back to BackTo, and reruns everything after
+// it, until the stage's output contains Until or MaxIterations runs are used.
+type WorkflowLoop struct {
+	BackTo        string `json:"back_to"`
+	Until         string `json:"until,omitempty"`
+	MaxIterations int    `json:"max_iterations,omitempty"`
+}
+
+// ParseWorkflow decodes a session's workflow column. Sessions without a
+// workflow get one with no stages.
+func ParseWorkflow(raw string) Workflow {
+	var w Workflow
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &w)
+	}
+	return w
+}
+
+// DebateConfig turns each user message into a debate: the models answer
+// without seeing each other, critique each other for CritiqueRounds rounds,
+// and then a judge synthesizes the final answer ("debate") or the models
+// vote for the best one ("consensus"). JudgeModel is a session model's short
+// ID or a provider model ID and defaults to the first session model.
+type DebateConfig struct {
+	Mode           string `json:"mode,omitempty"`
+	CritiqueRounds int    `json:"critique_rounds,omitempty"`
+	JudgeModel     string `json:"judge_model,omitempty"`
+}
+
+const (
+	DebateModeJudge = "debate"
+	DebateModeVote  = "consensus"
+)
+
+// ParseDebate decodes a session's debate column; an empty Mode means the
+// session does not debate.
+func ParseDebate(raw string) DebateConfig {
+	var d DebateConfig
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &d)
+	}
+	return d
 }
 
 const (
@@ -39,6 +238,17 @@ const (
 	RoleGeneral  = "general"
 )
 
+// Role is a user-defined role. Keywords are routing hints for the keyword
+// router, and SystemPrompt is the default prompt of models that have none.
+type Role struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Keywords     []string  `json:"keywords"`
+	SystemPrompt string    `json:"system_prompt"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
 type ProviderKey struct {
 	Provider  string    `json:"provider"`
 	APIKey    string    `json:"api_key"`
@@ -109,3 +319,472 @@ func SetProviderEnabled(provider string, enabled bool) error {
 	_, err := DB.Exec(`UPDATE provider_keys SET enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE provider = ?`, enabledInt, provider)
 	return err
 }
+
+type CustomProvider struct {
+	Name         string            `json:"name"`
+	BaseURL      string            `json:"base_url"`
+	APIKey       string            `json:"api_key"`
+	Headers      map[string]string `json:"headers"`
+	Models       []string          `json:"models"`
+	AutoDiscover bool              `json:"auto_discover"`
+	Enabled      bool              `json:"enabled"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so writes can be shared
+// between standalone calls and transactions.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func scanCustomProvider(row rowScanner) (*CustomProvider, error) {
+	var cp CustomProvider
+	var headersJSON, modelsJSON string
+	var autoDiscover, enabled int
+	if err := row.Scan(&cp.Name, &cp.BaseURL, &cp.APIKey, &headersJSON, &modelsJSON, &autoDiscover, &enabled, &cp.CreatedAt, &cp.UpdatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(headersJSON), &cp.Headers)
+	json.Unmarshal([]byte(modelsJSON), &cp.Models)
+	if cp.Headers == nil {
+		cp.Headers = map[string]string{}
+	}
+	if cp.Models == nil {
+		cp.Models = []string{}
+	}
+	cp.AutoDiscover = autoDiscover == 1
+	cp.Enabled = enabled == 1
+	return &cp, nil
+}
+
+func SaveCustomProvider(cp CustomProvider) error {
+	headersJSON, _ := json.Marshal(cp.Headers)
+	modelsJSON, _ := json.Marshal(cp.Models)
+	autoDiscover := 0
+	if cp.AutoDiscover {
+		autoDiscover = 1
+	}
+	enabled := 0
+	if cp.Enabled {
+		enabled = 1
+	}
+	_, err := DB.Exec(`
+		INSERT INTO custom_providers (name, base_url, api_key, headers, models, auto_discover, enabled, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(name) DO UPDATE SET
+			base_url = excluded.base_url,
+			api_key = excluded.api_key,
+			headers = excluded.headers,
+			models = excluded.models,
+			auto_discover = excluded.auto_discover,
+			enabled = excluded.enabled,
+			updated_at = CURRENT_TIMESTAMP
+	`, cp.Name, cp.BaseURL, cp.APIKey, string(headersJSON), string(modelsJSON), autoDiscover, enabled)
+	return err
+}
+
+func GetCustomProvider(name string) (*CustomProvider, error) {
+	return scanCustomProvider(DB.QueryRow(`
+		SELECT name, base_url, api_key, headers, models, auto_discover, enabled, created_at, updated_at
+		FROM custom_providers WHERE name = ?
+	`, name))
+}
+
+func GetAllCustomProviders() ([]CustomProvider, error) {
+	rows, err := DB.Query(`
+		SELECT name, base_url, api_key, headers, models, auto_discover, enabled, created_at, updated_at
+		FROM custom_providers ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var providers []CustomProvider
+	for rows.Next() {
+		cp, err := scanCustomProvider(rows)
+		if err != nil {
+			continue
+		}
+		providers = append(providers, *cp)
+	}
+	return providers, nil
+}
+
+func DeleteCustomProvider(name string) error {
+	_, err := DB.Exec(`DELETE FROM custom_providers WHERE name = ?`, name)
+	return err
+}
+
+// Persona is a reusable system prompt with defaults for the models that
+// reference it. Prompt may use the template variables BuildSystemPrompt
+// renders.
+type Persona struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	Prompt    string           `json:"prompt"`
+	Role      string           `json:"role"`
+	Params    GenerationParams `json:"params"`
+	Color     string           `json:"color"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+func scanPersona(row rowScanner) (*Persona, error) {
+	var p Persona
+	var paramsJSON string
+	if err := row.Scan(&p.ID, &p.Name, &p.Prompt, &p.Role, &paramsJSON, &p.Color, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(paramsJSON), &p.Params)
+	return &p, nil
+}
+
+func SavePersona(p Persona) error {
+	return savePersona(DB, p)
+}
+
+func savePersona(db execer, p Persona) error {
+	paramsJSON, _ := json.Marshal(p.Params)
+	_, err := db.Exec(`
+		INSERT INTO personas (id, name, prompt, role, params, color, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			prompt = excluded.prompt,
+			role = excluded.role,
+			params = excluded.params,
+			color = excluded.color,
+			updated_at = CURRENT_TIMESTAMP
+	`, p.ID, p.Name, p.Prompt, p.Role, string(paramsJSON), p.Color)
+	return err
+}
+
+func GetPersona(id string) (*Persona, error) {
+	return scanPersona(DB.QueryRow(`
+		SELECT id, name, prompt, role, params, color, created_at, updated_at
+		FROM personas WHERE id = ?
+	`, id))
+}
+
+func GetAllPersonas() ([]Persona, error) {
+	rows, err := DB.Query(`
+		SELECT id, name, prompt, role, params, color, created_at, updated_at
+		FROM personas ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var personas []Persona
+	for rows.Next() {
+		p, err := scanPersona(rows)
+		if err != nil {
+			continue
+		}
+		personas = append(personas, *p)
+	}
+	return personas, nil
+}
+
+func DeletePersona(id string) error {
+	_, err := DB.Exec(`DELETE FROM personas WHERE id = ?`, id)
+	return err
+}
+
+func scanRole(row rowScanner) (*Role, error) {
+	var r Role
+	var keywordsJSON string
+	if err := row.Scan(&r.Name, &r.Description, &keywordsJSON, &r.SystemPrompt, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(keywordsJSON), &r.Keywords)
+	if r.Keywords == nil {
+		r.Keywords = []string{}
+	}
+	return &r, nil
+}
+
+func SaveRole(r Role) error {
+	keywordsJSON, _ := json.Marshal(r.Keywords)
+	_, err := DB.Exec(`
+		INSERT INTO roles (name, description, keywords, system_prompt, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(name) DO UPDATE SET
+			description = excluded.description,
+			keywords = excluded.keywords,
+			system_prompt = excluded.system_prompt,
+			updated_at = CURRENT_TIMESTAMP
+	`, r.Name, r.Description, string(keywordsJSON), r.SystemPrompt)
+	return err
+}
+
+func GetRole(name string) (*Role, error) {
+	return scanRole(DB.QueryRow(`
+		SELECT name, description, keywords, system_prompt, created_at, updated_at
+		FROM roles WHERE name = ?
+	`, name))
+}
+
+func GetAllRoles() ([]Role, error) {
+	rows, err := DB.Query(`
+		SELECT name, description, keywords, system_prompt, created_at, updated_at
+		FROM roles ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []Role
+	for rows.Next() {
+		r, err := scanRole(rows)
+		if err != nil {
+			continue
+		}
+		roles = append(roles, *r)
+	}
+	return roles, nil
+}
+
+func DeleteRole(name string) error {
+	_, err := DB.Exec(`DELETE FROM roles WHERE name = ?`, name)
+	return err
+}
+
+const messageColumns = `id, session_id, parent_id, role, model_id, model_name, content, round_number, tokens_used, attachments, pinned, kind, routing, created_at`
+
+func scanMessage(row rowScanner) (*Message, error) {
+	var m Message
+	var attachmentsJSON *string
+	var routingJSON *string
+	var pinned int
+	if err := row.Scan(&m.ID, &m.SessionID, &m.ParentID, &m.Role, &m.ModelID, &m.ModelName, &m.Content, &m.RoundNumber, &m.TokensUsed, &attachmentsJSON, &pinned, &m.Kind, &routingJSON, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	m.Pinned = pinned == 1
+	if attachmentsJSON != nil {
+		json.Unmarshal([]byte(*attachmentsJSON), &m.Attachments)
+	}
+	if routingJSON != nil && *routingJSON != "" {
+		m.Routing = &RoutingDecision{}
+		json.Unmarshal([]byte(*routingJSON), m.Routing)
+	}
+	return &m, nil
+}
+
+// InsertMessage stores a message and makes it the session's active leaf.
+func InsertMessage(m Message) error {
+	if err := insertMessage(DB, m); err != nil {
+		return err
+	}
+	return SetActiveLeaf(m.SessionID, m.ID)
+}
+
+func insertMessage(db execer, m Message) error {
+	var attachmentsJSON *string
+	if len(m.Attachments) > 0 {
+		data, _ := json.Marshal(m.Attachments)
+		encoded := string(data)
+		attachmentsJSON = &encoded
+	}
+	var routingJSON *string
+	if m.Routing != nil {
+		data, _ := json.Marshal(m.Routing)
+		encoded := string(data)
+		routingJSON = &encoded
+	}
+	pinned := 0
+	if m.Pinned {
+		pinned = 1
+	}
+	_, err := db.Exec(`
+		INSERT INTO messages (`+messageColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, m.ID, m.SessionID, m.ParentID, m.Role, m.ModelID, m.ModelName, m.Content, m.RoundNumber, m.TokensUsed, attachmentsJSON, pinned, m.Kind, routingJSON, m.CreatedAt)
+	return err
+}
+
+func GetMessage(sessionID, messageID string) (*Message, error) {
+	return scanMessage(DB.QueryRow(`
+		SELECT `+messageColumns+`
+		FROM messages WHERE id = ? AND session_id = ?
+	`, messageID, sessionID))
+}
+
+// ListMessages returns every message of a session across all branches.
+func ListMessages(sessionID string) ([]Message, error) {
+	rows, err := DB.Query(`
+		SELECT `+messageColumns+`
+		FROM messages WHERE session_id = ? ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, *m)
+	}
+	return messages, nil
+}
+
+func SetActiveLeaf(sessionID, messageID string) error {
+	_, err := DB.Exec(`UPDATE sessions SET active_leaf_id = ? WHERE id = ?`, messageID, sessionID)
+	return err
+}
+
+func GetActiveLeaf(sessionID string) *string {
+	var leafID *string
+	DB.QueryRow(`SELECT active_leaf_id FROM sessions WHERE id = ?`, sessionID).Scan(&leafID)
+	return leafID
+}
+
+// ListBranch returns the messages on the session's active branch, from the
+// root down to the active leaf. Sessions without a recorded leaf follow the
+// newest message.
+func ListBranch(sessionID string) ([]Message, error) {
+	leafID := GetActiveLeaf(sessionID)
+
+	all, err := ListMessages(sessionID)
+	if err != nil || len(all) == 0 {
+		return all, err
+	}
+
+	leaf := all[len(all)-1].ID
+	if leafID != nil {
+		leaf = *leafID
+	}
+	return PathTo(all, leaf), nil
+}
+
+// PathTo walks parent links from messageID back to the root and returns the
+// path in conversation order.
+func PathTo(all []Message, messageID string) []Message {
+	byID := make(map[string]Message, len(all))
+	for _, m := range all {
+		byID[m.ID] = m
+	}
+
+	var path []Message
+	m, ok := byID[messageID]
+	for ok && len(path) < len(all) {
+		path = append(path, m)
+		if m.ParentID == nil {
+			break
+		}
+		m, ok = byID[*m.ParentID]
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// LatestLeaf returns the newest message in the subtree below messageID, so
+// switching to a branch lands on its most recent turn.
+func LatestLeaf(all []Message, messageID string) string {
+	children := make(map[string][]Message)
+	for _, m := range all {
+		if m.ParentID != nil {
+			children[*m.ParentID] = append(children[*m.ParentID], m)
+		}
+	}
+
+	leaf := messageID
+	for {
+		next := children[leaf]
+		if len(next) == 0 {
+			return leaf
+		}
+		// Messages are ordered by created_at, so the last child is the newest
+		leaf = next[len(next)-1].ID
+	}
+}
+
+func SetMessagePinned(sessionID, messageID string, pinned bool) (bool, error) {
+	pinnedInt := 0
+	if pinned {
+		pinnedInt = 1
+	}
+	result, err := DB.Exec(`UPDATE messages SET pinned = ? WHERE id = ? AND session_id = ?`, pinnedInt, messageID, sessionID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// SetMessageRouting records how a user message was routed.
+func SetMessageRouting(sessionID, messageID string, d RoutingDecision) error {
+	data, _ := json.Marshal(d)
+	_, err := DB.Exec(`UPDATE messages SET routing = ? WHERE id = ? AND session_id = ?`, string(data), messageID, sessionID)
+	return err
+}
+
+const attachmentColumns = `id, session_id, file_name, mime_type, size, COALESCE(sha256, ''), COALESCE(pages, 0), COALESCE(content, ''), COALESCE(structure, ''), path, created_at`
+
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var a Attachment
+	if err := row.Scan(&a.ID, &a.SessionID, &a.FileName, &a.MimeType, &a.Size, &a.SHA256, &a.Pages, &a.Content, &a.Structure, &a.Path, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func SaveAttachment(a Attachment) error {
+	return saveAttachment(DB, a)
+}
+
+func saveAttachment(db execer, a Attachment) error {
+	_, err := db.Exec(`
+		INSERT INTO attachments (id, session_id, file_name, mime_type, size, sha256, pages, content, structure, path, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, a.ID, a.SessionID, a.FileName, a.MimeType, a.Size, a.SHA256, a.Pages, a.Content, a.Structure, a.Path, a.CreatedAt)
+	return err
+}
+
+func GetAttachment(id string) (*Attachment, error) {
+	return scanAttachment(DB.QueryRow(`
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE id = ?
+	`, id))
+}
+
+func ListSessionAttachments(sessionID string) ([]Attachment, error) {
+	rows, err := DB.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments WHERE session_id = ? ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			continue
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, nil
+}
+
+func DeleteAttachment(id string) error {
+	_, err := DB.Exec(`DELETE FROM attachments WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+type SearchOptions struct {
+	Query string
+	Model string
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+type MessageHit struct {
+	MessageID   string    `json:"message_id"`
+	SessionID   string    `json:"session_id"`
+	SessionName string    `json:"session_name"`
+	Role        string    `json:"role"`
+	ModelID     *string   `json:"model_id"`
+	ModelName   *string   `json:"model_name"`
+	Snippet     string    `json:"snippet"`
+	Rank        float64   `json:"rank"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type SessionHit struct {
+	SessionID string    `json:"session_id"`
+	Name      string    `json:"name"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ftsQuery turns free text into an FTS5 query that matches all words, with
+// the last word treated as a prefix. Quoting every term keeps characters
+// like '-' or ':' from being parsed as FTS operators.
+func ftsQuery(text string) string {
+	terms := strings.Fields(text)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	if len(terms) > 0 {
+		terms[len(terms)-1] += "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// storedTime formats t the way the SQLite driver wrote the app's timestamps:
+// time.Time.String in local time. Timestamps are compared as text, so range
+// bounds must use the same format and zone.
+func storedTime(t time.Time) string {
+	return t.Local().Round(0).String()
+}
+
+// SearchMessages returns messages matching the query, best match first.
+// Model matches either the short ID or the display name; "user" selects
+// user messages.
+func SearchMessages(opts SearchOptions) ([]MessageHit, error) {
+	query := `
+		SELECT m.id, m.session_id, s.name, m.role, m.model_id, m.model_name,
+			snippet(messages_fts, 0, '<mark>', '</mark>', '…', 16), bm25(messages_fts), m.created_at
+		FROM messages_fts
+		JOIN messages m ON m.id = messages_fts.message_id
+		JOIN sessions s ON s.id = m.session_id
+		WHERE messages_fts MATCH ?`
+	args := []interface{}{ftsQuery(opts.Query)}
+
+	if opts.Model != "" {
+		if strings.EqualFold(opts.Model, "user") {
+			query += ` AND m.role = 'user'`
+		} else {
+			query += ` AND (m.model_id = ? COLLATE NOCASE OR m.model_name = ? COLLATE NOCASE)`
+			args = append(args, opts.Model, opts.Model)
+		}
+	}
+	if opts.From != nil {
+		query += ` AND m.created_at >= ?`
+		args = append(args, storedTime(*opts.From))
+	}
+	if opts.To != nil {
+		query += ` AND m.created_at < ?`
+		args = append(args, storedTime(*opts.To))
+	}
+	query += ` ORDER BY bm25(messages_fts) LIMIT ?`
+	args = append(args, opts.Limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []MessageHit{}
+	for rows.Next() {
+		var h MessageHit
+		if err := rows.Scan(&h.MessageID, &h.SessionID, &h.SessionName, &h.Role, &h.ModelID, &h.ModelName, &h.Snippet, &h.Rank, &h.CreatedAt); err != nil {
+			continue
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+// SearchSessions returns sessions whose name matches the query, filtered by
+// when they were last updated.
+func SearchSessions(opts SearchOptions) ([]SessionHit, error) {
+	query := `
+		SELECT s.id, s.name, snippet(sessions_fts, 0, '<mark>', '</mark>', '…', 16), bm25(sessions_fts), s.updated_at
+		FROM sessions_fts
+		JOIN sessions s ON s.id = sessions_fts.session_id
+		WHERE sessions_fts MATCH ?`
+	args := []interface{}{ftsQuery(opts.Query)}
+
+	if opts.From != nil {
+		query += ` AND s.updated_at >= ?`
+		args = append(args, storedTime(*opts.From))
+	}
+	if opts.To != nil {
+		query += ` AND s.updated_at < ?`
+		args = append(args, storedTime(*opts.To))
+	}
+	query += ` ORDER BY bm25(sessions_fts) LIMIT ?`
+	args = append(args, opts.Limit)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hits := []SessionHit{}
+	for rows.Next() {
+		var h SessionHit
+		if err := rows.Scan(&h.SessionID, &h.Name, &h.Snippet, &h.Rank, &h.UpdatedAt); err != nil {
+			continue
+		}
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchDateRangeUsesStoredZone(t *testing.T) {
+	openTestDB(t)
+	if err := migrate(); err != nil {
+		t.Fatal(err)
+	}
+	local := time.Local
+	time.Local = time.FixedZone("CEST", 2*60*60)
+	defer func() { time.Local = local }()
+
+	// 01:00 local on New Year's Day is still the old year in UTC
+	at := time.Date(2024, 1, 1, 1, 0, 0, 0, time.Local)
+	created := at.AddDate(0, -1, 0)
+	if _, err := DB.Exec(`INSERT INTO sessions (id, name, model_configs, created_at, updated_at) VALUES ('s1', 'Fruit planning', '[]', ?, ?)`, created, at); err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertMessage(Message{ID: "m1", SessionID: "s1", Role: "user", Content: "bananas", CreatedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2023, 12, 31, 22, 30, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC)
+	opts := SearchOptions{From: &from, To: &to, Limit: 10}
+
+	opts.Query = "bananas"
+	if hits, err := SearchMessages(opts); err != nil || len(hits) != 1 {
+		t.Errorf("found %d messages (%v), want the one inside the UTC range", len(hits), err)
+	}
+	opts.Query = "fruit"
+	if hits, err := SearchSessions(opts); err != nil || len(hits) != 1 {
+		t.Errorf("found %d sessions (%v), want the one updated inside the range", len(hits), err)
+	}
+
+	earlier := to.AddDate(0, 0, -1)
+	opts.To = &earlier
+	if hits, _ := SearchSessions(opts); len(hits) != 0 {
+		t.Errorf("found %d sessions before the range", len(hits))
+	}
+}
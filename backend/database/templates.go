@@ -0,0 +1,137 @@
+package database
+
+import "time"
+
+// SessionTemplate holds a session's settings without its messages, for
+// starting new sessions with the same team of models. The settings are
+// stored as in the sessions table.
+type SessionTemplate struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Description       string    `json:"description"`
+	ModelConfigs      string    `json:"model_configs"`
+	AutonomyRounds    int       `json:"autonomy_rounds"`
+	TurnTaking        string    `json:"turn_taking"`
+	Workflow          string    `json:"workflow"`
+	Debate            string    `json:"debate"`
+	ParallelResponses bool      `json:"parallel_responses"`
+	Router            string    `json:"router"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+const templateColumns = `id, name, description, model_configs, autonomy_rounds, turn_taking, workflow, debate, parallel_responses, router, created_at, updated_at`
+
+func scanTemplate(row rowScanner) (*SessionTemplate, error) {
+	var t SessionTemplate
+	var parallel int
+	if err := row.Scan(&t.ID, &t.Name, &t.Description, &t.ModelConfigs, &t.AutonomyRounds, &t.TurnTaking, &t.Workflow, &t.Debate, &parallel, &t.Router, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.ParallelResponses = parallel == 1
+	return &t, nil
+}
+
+func InsertTemplate(t SessionTemplate) error {
+	parallel := 0
+	if t.ParallelResponses {
+		parallel = 1
+	}
+	_, err := DB.Exec(`
+		INSERT INTO session_templates (`+templateColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, t.ID, t.Name, t.Description, t.ModelConfigs, t.AutonomyRounds, t.TurnTaking, t.Workflow, t.Debate, parallel, t.Router, t.CreatedAt, t.UpdatedAt)
+	return err
+}
+
+func GetTemplate(id string) (*SessionTemplate, error) {
+	return scanTemplate(DB.QueryRow(`
+		SELECT `+templateColumns+`
+		FROM session_templates WHERE id = ?
+	`, id))
+}
+
+func ListTemplates() ([]SessionTemplate, error) {
+	rows, err := DB.Query(`
+		SELECT ` + templateColumns + `
+		FROM session_templates ORDER BY name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []SessionTemplate
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			continue
+		}
+		templates = append(templates, *t)
+	}
+	return templates, nil
+}
+
+func DeleteTemplate(id string) error {
+	_, err := DB.Exec(`DELETE FROM session_templates WHERE id = ?`, id)
+	return err
+}
+
+// SessionCopy is a cloned session with everything copied along with it.
+// IDs must already be remapped; chunks are keyed by their new document ID.
+type SessionCopy struct {
+	Session     Session
+	Personas    []Persona
+	Messages    []Message
+	Attachments []Attachment
+	Documents   []Document
+	Chunks      map[string][]DocumentChunk
+	ActiveLeaf  *string
+}
+
+// InsertSessionCopy writes a cloned session in one transaction, so a failed
+// copy leaves no partial session behind.
+func InsertSessionCopy(c SessionCopy) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	s := c.Session
+	_, err = tx.Exec(`
+		INSERT INTO sessions (id, name, model_configs, autonomy_rounds, turn_taking, workflow, debate, parallel_responses, router, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.ID, s.Name, s.ModelConfigs, s.AutonomyRounds, s.TurnTaking, s.Workflow, s.Debate, s.ParallelResponses, s.Router, s.CreatedAt, s.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range c.Personas {
+		if err := savePersona(tx, p); err != nil {
+			return err
+		}
+	}
+	for _, a := range c.Attachments {
+		if err := saveAttachment(tx, a); err != nil {
+			return err
+		}
+	}
+	for _, m := range c.Messages {
+		if err := insertMessage(tx, m); err != nil {
+			return err
+		}
+	}
+	for _, d := range c.Documents {
+		if err := insertDocument(tx, d, c.Chunks[d.ID]); err != nil {
+			return err
+		}
+	}
+	if c.ActiveLeaf != nil {
+		if _, err := tx.Exec(`UPDATE sessions SET active_leaf_id = ? WHERE id = ?`, *c.ActiveLeaf, s.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB points DB at a fresh database in a temporary directory.
+func openTestDB(t *testing.T) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := DB
+	DB = db
+	t.Cleanup(func() {
+		db.Close()
+		DB = previous
+	})
+}
+
+func TestInsertSessionCopy(t *testing.T) {
+	openTestDB(t)
+	if err := migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	parent, leaf := "m1", "m2"
+	clone := SessionCopy{
+		Session: Session{ID: "s1", Name: "copy", ModelConfigs: "[]", CreatedAt: now, UpdatedAt: now},
+		Messages: []Message{
+			{ID: "m1", SessionID: "s1", Role: "user", Content: "hi", CreatedAt: now},
+			{ID: "m2", SessionID: "s1", ParentID: &parent, Role: "user", Content: "again", CreatedAt: now},
+		},
+		Documents: []Document{{ID: "d1", SessionID: "s1", FileName: "a.txt", EmbeddingModel: "e", CreatedAt: now}},
+		Chunks: map[string][]DocumentChunk{
+			"d1": {{Index: 0, Content: "chunk", Embedding: []float32{1, 2}}},
+		},
+		ActiveLeaf: &leaf,
+	}
+	if err := InsertSessionCopy(clone); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GetActiveLeaf("s1"); got == nil || *got != "m2" {
+		t.Errorf("active leaf = %v, want m2", got)
+	}
+	chunks, err := ListSessionChunks("s1")
+	if err != nil || len(chunks) != 1 || chunks[0].FileName != "a.txt" {
+		t.Errorf("chunks = %+v, err %v", chunks, err)
+	}
+
+	// A duplicate message ID fails halfway through and must leave nothing behind
+	broken := clone
+	broken.Session.ID = "s2"
+	broken.Messages = []Message{
+		{ID: "m3", SessionID: "s2", Role: "user", Content: "hi", CreatedAt: now},
+		{ID: "m3", SessionID: "s2", Role: "user", Content: "dup", CreatedAt: now},
+	}
+	broken.Documents = nil
+	broken.ActiveLeaf = nil
+	if err := InsertSessionCopy(broken); err == nil {
+		t.Fatal("expected an error for duplicate message IDs")
+	}
+	var count int
+	DB.QueryRow(`SELECT COUNT(*) FROM sessions WHERE id = 's2'`).Scan(&count)
+	if count != 0 {
+		t.Error("failed copy left its session behind")
+	}
+	DB.QueryRow(`SELECT COUNT(*) FROM messages WHERE session_id = 's2'`).Scan(&count)
+	if count != 0 {
+		t.Error("failed copy left messages behind")
+	}
+}
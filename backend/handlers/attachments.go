@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+	"localai/services"
+)
+
+// storeUpload saves the multipart "file" as an attachment, linked to the
+// session named by the optional "session_id" form field.
+func storeUpload(c *fiber.Ctx) (*database.Attachment, int, error) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, 400, errors.New("file is required")
+	}
+
+	var sessionID *string
+	if id := c.FormValue("session_id"); id != "" {
+		var exists bool
+		database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sessions WHERE id = ?)", id).Scan(&exists)
+		if !exists {
+			return nil, 404, errors.New("Session not found")
+		}
+		sessionID = &id
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, 400, errors.New("Failed to read upload")
+	}
+	defer file.Close()
+
+	attachment, err := services.StoreAttachment(sessionID, fileHeader.Filename, file)
+	if err != nil {
+		return nil, 400, err
+	}
+	return attachment, 200, nil
+}
+
+// checkSessionAttachments rejects attachment IDs a message in the session may
+// not reference: unknown ones and those uploaded to another session.
+func checkSessionAttachments(sessionID string, ids []string) error {
+	for _, id := range ids {
+		attachment, err := database.GetAttachment(id)
+		if err != nil {
+			return errors.New("Attachment not found")
+		}
+		if attachment.SessionID != nil && *attachment.SessionID != sessionID {
+			return errors.New("Attachment belongs to another session")
+		}
+	}
+	return nil
+}
+
+func UploadAttachment(c *fiber.Ctx) error {
+	attachment, status, err := storeUpload(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(attachment)
+}
+
+func GetAttachment(c *fiber.Ctx) error {
+	attachment, err := database.GetAttachment(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	c.Set("Content-Type", attachment.MimeType)
+	return c.SendFile(attachment.Path)
+}
+
+func DeleteAttachment(c *fiber.Ctx) error {
+	attachment, err := database.GetAttachment(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	if err := services.RemoveAttachment(attachment); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"status": "deleted"})
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"localai/database"
+)
+
+func TestCheckSessionAttachments(t *testing.T) {
+	initTestDB(t)
+
+	own, other := "s1", "s2"
+	for _, a := range []database.Attachment{
+		{ID: "mine", SessionID: &own, FileName: "a.png", MimeType: "image/png", CreatedAt: time.Now()},
+		{ID: "theirs", SessionID: &other, FileName: "b.png", MimeType: "image/png", CreatedAt: time.Now()},
+		{ID: "unlinked", FileName: "c.png", MimeType: "image/png", CreatedAt: time.Now()},
+	} {
+		if err := database.SaveAttachment(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		ids     []string
+		wantErr bool
+	}{
+		{nil, false},
+		{[]string{"mine", "unlinked"}, false},
+		{[]string{"mine", "theirs"}, true},
+		{[]string{"missing"}, true},
+	}
+	for _, tt := range tests {
+		err := checkSessionAttachments(own, tt.ids)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("checkSessionAttachments(%v) = %v, want error %v", tt.ids, err, tt.wantErr)
+		}
+	}
+}
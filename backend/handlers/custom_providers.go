@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+	"localai/services"
+)
+
+type CustomProviderRequest struct {
+	Name         string            `json:"name"`
+	BaseURL      string            `json:"base_url"`
+	APIKey       *string           `json:"api_key,omitempty"`
+	Headers      map[string]string `json:"headers"`
+	Models       []string          `json:"models"`
+	AutoDiscover *bool             `json:"auto_discover,omitempty"`
+	Enabled      *bool             `json:"enabled,omitempty"`
+}
+
+// CustomProviderResponse hides secrets: the API key is only reported as set,
+// and headers, which often carry gateway credentials, only by name.
+type CustomProviderResponse struct {
+	Name         string   `json:"name"`
+	BaseURL      string   `json:"base_url"`
+	HasAPIKey    bool     `json:"has_api_key"`
+	HeaderNames  []string `json:"header_names"`
+	Models       []string `json:"models"`
+	AutoDiscover bool     `json:"auto_discover"`
+	Enabled      bool     `json:"enabled"`
+}
+
+var customProviderNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func toCustomProviderResponse(cp database.CustomProvider) CustomProviderResponse {
+	headerNames := make([]string, 0, len(cp.Headers))
+	for name := range cp.Headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+
+	return CustomProviderResponse{
+		Name:         cp.Name,
+		BaseURL:      cp.BaseURL,
+		HasAPIKey:    cp.APIKey != "",
+		HeaderNames:  headerNames,
+		Models:       cp.Models,
+		AutoDiscover: cp.AutoDiscover,
+		Enabled:      cp.Enabled,
+	}
+}
+
+func isBuiltinProvider(name string) bool {
+	if _, ok := services.OpenAIProviderConfigs[name]; ok {
+		return true
+	}
+	return name == "ollama" || name == "anthropic" || name == "gemini" || name == "custom"
+}
+
+func validateBaseURL(baseURL string) (string, bool) {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return baseURL, true
+}
+
+func applyCustomProvider(cp database.CustomProvider) {
+	services.SetCustomProviderConfig(cp)
+	if cp.Enabled {
+		services.RegisterOpenAIProvider(cp.Name, cp.APIKey)
+	} else {
+		services.Providers.Unregister(cp.Name)
+	}
+}
+
+func ListCustomProviders(c *fiber.Ctx) error {
+	providers, err := database.GetAllCustomProviders()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result := make([]CustomProviderResponse, len(providers))
+	for i, cp := range providers {
+		result[i] = toCustomProviderResponse(cp)
+	}
+
+	return c.JSON(result)
+}
+
+func CreateCustomProvider(c *fiber.Ctx) error {
+	var req CustomProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if !customProviderNamePattern.MatchString(req.Name) {
+		return c.Status(400).JSON(fiber.Map{"error": "Name must contain only lowercase letters, digits, '-' and '_'"})
+	}
+	if isBuiltinProvider(req.Name) {
+		return c.Status(400).JSON(fiber.Map{"error": "Name conflicts with a built-in provider"})
+	}
+	if _, err := database.GetCustomProvider(req.Name); err == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Provider already exists"})
+	}
+
+	baseURL, ok := validateBaseURL(req.BaseURL)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "base_url must be a valid http(s) URL"})
+	}
+
+	cp := database.CustomProvider{
+		Name:    req.Name,
+		BaseURL: baseURL,
+		Headers: req.Headers,
+		Models:  req.Models,
+		Enabled: true,
+	}
+	if req.AutoDiscover != nil {
+		cp.AutoDiscover = *req.AutoDiscover
+	}
+	if len(cp.Models) == 0 && !cp.AutoDiscover {
+		return c.Status(400).JSON(fiber.Map{"error": "Provide a model list or enable auto_discover"})
+	}
+	if req.APIKey != nil {
+		cp.APIKey = *req.APIKey
+	}
+	if req.Enabled != nil {
+		cp.Enabled = *req.Enabled
+	}
+
+	if err := database.SaveCustomProvider(cp); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save provider"})
+	}
+
+	saved, err := database.GetCustomProvider(cp.Name)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	applyCustomProvider(*saved)
+
+	return c.JSON(toCustomProviderResponse(*saved))
+}
+
+func UpdateCustomProvider(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	cp, err := database.GetCustomProvider(name)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Provider not found"})
+	}
+
+	var req CustomProviderRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.BaseURL != "" {
+		baseURL, ok := validateBaseURL(req.BaseURL)
+		if !ok {
+			return c.Status(400).JSON(fiber.Map{"error": "base_url must be a valid http(s) URL"})
+		}
+		cp.BaseURL = baseURL
+	}
+	if req.APIKey != nil {
+		cp.APIKey = *req.APIKey
+	}
+	if req.Headers != nil {
+		cp.Headers = req.Headers
+	}
+	if req.Models != nil {
+		cp.Models = req.Models
+	}
+	if req.AutoDiscover != nil {
+		cp.AutoDiscover = *req.AutoDiscover
+	}
+	if req.Enabled != nil {
+		cp.Enabled = *req.Enabled
+	}
+
+	if len(cp.Models) == 0 && !cp.AutoDiscover {
+		return c.Status(400).JSON(fiber.Map{"error": "Provide a model list or enable auto_discover"})
+	}
+
+	if err := database.SaveCustomProvider(*cp); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save provider"})
+	}
+	applyCustomProvider(*cp)
+
+	return c.JSON(toCustomProviderResponse(*cp))
+}
+
+func DeleteCustomProvider(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if _, err := database.GetCustomProvider(name); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Provider not found"})
+	}
+
+	if err := database.DeleteCustomProvider(name); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete provider"})
+	}
+
+	services.Providers.Unregister(name)
+	services.RemoveCustomProviderConfig(name)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Provider deleted"})
+}
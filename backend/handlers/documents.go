@@ -1,21 +1,22 @@
 package handlers
 
 import (
+	"strings"
+
+	"localai/database"
 	"localai/services"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-type ParseDocumentRequest struct {
-	FilePath string `json:"file_path"`
-}
-
 type ParseDocumentResponse struct {
-	Success  bool   `json:"success"`
-	Content  string `json:"content"`
-	FileName string `json:"file_name"`
-	FileType string `json:"file_type"`
-	Pages    int    `json:"pages"`
+	Success      bool                    `json:"success"`
+	AttachmentID string                  `json:"attachment_id"`
+	Content      string                  `json:"content"`
+	FileName     string                  `json:"file_name"`
+	FileType     string                  `json:"file_type"`
+	Pages        int                     `json:"pages"`
+	Structure    []services.DocumentPage `json:"structure,omitempty"`
 }
 
 type ParseDocumentErrorResponse struct {
@@ -23,43 +24,119 @@ type ParseDocumentErrorResponse struct {
 	Error   string `json:"error"`
 }
 
-func ParseDocument(c *fiber.Ctx) error {
-	var req ParseDocumentRequest
-
-	if err := c.BodyParser(&req); err != nil {
+// UploadDocument stores an uploaded document as an attachment and returns its
+// extracted text. Messages can then reference it by attachment ID, and it can
+// be indexed for retrieval with IndexSessionDocument.
+func UploadDocument(c *fiber.Ctx) error {
+	if fileHeader, err := c.FormFile("file"); err == nil && !services.IsSupportedDocument(fileHeader.Filename) {
 		return c.Status(fiber.StatusBadRequest).JSON(ParseDocumentErrorResponse{
 			Success: false,
-			Error:   "Invalid request body",
+			Error:   "Unsupported file type. Supported types: " + strings.Join(services.DocumentParsers.Extensions(), ", "),
 		})
 	}
 
-	if req.FilePath == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(ParseDocumentErrorResponse{
+	attachment, status, err := storeUpload(c)
+	if err != nil {
+		return c.Status(status).JSON(ParseDocumentErrorResponse{
 			Success: false,
-			Error:   "file_path is required",
+			Error:   err.Error(),
 		})
 	}
 
-	if !services.IsSupportedDocument(req.FilePath) {
-		return c.Status(fiber.StatusBadRequest).JSON(ParseDocumentErrorResponse{
-			Success: false,
-			Error:   "Unsupported file type. Supported types: .pdf, .docx",
-		})
+	result := services.DocumentParseResultFor(attachment)
+	return c.JSON(ParseDocumentResponse{
+		Success:      true,
+		AttachmentID: attachment.ID,
+		Content:      result.Content,
+		FileName:     result.FileName,
+		FileType:     result.FileType,
+		Pages:        result.Pages,
+		Structure:    result.Structure,
+	})
+}
+
+type IndexDocumentRequest struct {
+	AttachmentID   string `json:"attachment_id"`
+	FileName       string `json:"file_name"`
+	FileType       string `json:"file_type"`
+	Pages          int    `json:"pages"`
+	Content        string `json:"content"`
+	EmbeddingModel string `json:"embedding_model"`
+}
+
+// invalidateSessionRetrieval makes a live session pick up document changes.
+func invalidateSessionRetrieval(sessionID string) {
+	orchMu.RLock()
+	orch := orchestrators[sessionID]
+	orchMu.RUnlock()
+	if orch != nil {
+		orch.InvalidateRetrieval()
+	}
+}
+
+// IndexSessionDocument adds parsed document text to a session's document
+// store so relevant passages are retrieved during chat.
+func IndexSessionDocument(c *fiber.Ctx) error {
+	sessionID := c.Params("id")
+
+	var exists bool
+	database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM sessions WHERE id = ?)", sessionID).Scan(&exists)
+	if !exists {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	var req IndexDocumentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	parsed := &services.DocumentParseResult{
+		Content:  req.Content,
+		FileName: req.FileName,
+		FileType: req.FileType,
+		Pages:    req.Pages,
+	}
+	if req.AttachmentID != "" {
+		attachment, err := database.GetAttachment(req.AttachmentID)
+		if err != nil || !services.IsDocumentAttachment(attachment) || (attachment.SessionID != nil && *attachment.SessionID != sessionID) {
+			return c.Status(404).JSON(fiber.Map{"error": "Document attachment not found"})
+		}
+		parsed = services.DocumentParseResultFor(attachment)
+	} else if req.FileName == "" || req.Content == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "attachment_id, or file_name and content, are required"})
 	}
 
-	result, err := services.ParseDocument(req.FilePath)
+	doc, err := services.IndexDocument(c.UserContext(), sessionID, parsed, req.EmbeddingModel)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(ParseDocumentErrorResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		return c.Status(502).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	return c.JSON(ParseDocumentResponse{
-		Success:  true,
-		Content:  result.Content,
-		FileName: result.FileName,
-		FileType: result.FileType,
-		Pages:    result.Pages,
-	})
+	invalidateSessionRetrieval(sessionID)
+	return c.JSON(doc)
+}
+
+func ListSessionDocuments(c *fiber.Ctx) error {
+	documents, err := database.ListDocuments(c.Params("id"))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if documents == nil {
+		documents = []database.Document{}
+	}
+	return c.JSON(documents)
+}
+
+func DeleteSessionDocument(c *fiber.Ctx) error {
+	sessionID := c.Params("id")
+
+	doc, err := database.GetDocument(sessionID, c.Params("docId"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
+	}
+	if err := database.DeleteDocument(doc.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	invalidateSessionRetrieval(sessionID)
+	return c.JSON(fiber.Map{"status": "deleted"})
 }
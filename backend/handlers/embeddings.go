@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/services"
+)
+
+type EmbeddingRequest struct {
+	Model          string     `json:"model"`
+	Input          stringList `json:"input"`
+	EncodingFormat string     `json:"encoding_format,omitempty"`
+}
+
+type EmbeddingData struct {
+	Object    string      `json:"object"`
+	Index     int         `json:"index"`
+	Embedding interface{} `json:"embedding"`
+}
+
+// checkEmbeddingModel returns an error status and message when a model can't
+// be used for embeddings, or a zero status when it can.
+func checkEmbeddingModel(modelID string) (int, string) {
+	provider := services.Providers.GetForModel(modelID)
+	if provider == nil {
+		return 404, fmt.Sprintf("The model '%s' does not exist", modelID)
+	}
+	if _, ok := provider.(services.Embedder); !ok {
+		return 400, fmt.Sprintf("%s does not support embeddings", provider.Name())
+	}
+	return 0, ""
+}
+
+// CreateEmbeddings embeds one or more texts with the given model.
+func CreateEmbeddings(c *fiber.Ctx) error {
+	var req EmbeddingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "input must be a string or an array of strings"})
+	}
+	if req.Model == "" {
+		req.Model = services.DefaultEmbeddingModel
+	}
+	if len(req.Input) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "input is required"})
+	}
+	if status, msg := checkEmbeddingModel(req.Model); status != 0 {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	vectors, err := services.Embed(c.UserContext(), req.Model, req.Input)
+	if err != nil {
+		return c.Status(502).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	dimensions := 0
+	if len(vectors) > 0 {
+		dimensions = len(vectors[0])
+	}
+	return c.JSON(fiber.Map{
+		"model":      req.Model,
+		"embeddings": vectors,
+		"dimensions": dimensions,
+	})
+}
+
+// OpenAIEmbeddings implements the OpenAI embeddings endpoint. The official
+// clients request base64 output by default, so both encodings are supported.
+func OpenAIEmbeddings(c *fiber.Ctx) error {
+	var req EmbeddingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return openAIError(c, 400, "invalid_request_error", "input must be a string or an array of strings")
+	}
+	if req.Model == "" {
+		return openAIError(c, 400, "invalid_request_error", "model is required")
+	}
+	if len(req.Input) == 0 {
+		return openAIError(c, 400, "invalid_request_error", "input must not be empty")
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" && req.EncodingFormat != "base64" {
+		return openAIError(c, 400, "invalid_request_error", "encoding_format must be float or base64")
+	}
+	if status, msg := checkEmbeddingModel(req.Model); status != 0 {
+		return openAIError(c, status, "invalid_request_error", msg)
+	}
+
+	vectors, err := services.Embed(c.UserContext(), req.Model, req.Input)
+	if err != nil {
+		return upstreamError(c, err)
+	}
+
+	data := make([]EmbeddingData, len(vectors))
+	for i, v := range vectors {
+		data[i] = EmbeddingData{Object: "embedding", Index: i, Embedding: v}
+		if req.EncodingFormat == "base64" {
+			data[i].Embedding = encodeFloat32Base64(v)
+		}
+	}
+
+	promptTokens := 0
+	for _, text := range req.Input {
+		promptTokens += services.EstimateTokens(text)
+	}
+
+	return c.JSON(fiber.Map{
+		"object": "list",
+		"data":   data,
+		"model":  req.Model,
+		"usage": fiber.Map{
+			"prompt_tokens": promptTokens,
+			"total_tokens":  promptTokens,
+		},
+	})
+}
+
+func encodeFloat32Base64(v []float32) string {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
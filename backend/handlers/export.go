@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"localai/database"
+	"localai/services"
+)
+
+var fileNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func exportFileName(name, ext string) string {
+	base := strings.Trim(fileNameUnsafe.ReplaceAllString(name, "-"), "-")
+	if base == "" {
+		base = "session"
+	}
+	return base + ext
+}
+
+// ExportSession downloads a session as markdown, json or jsonl. Markdown and
+// JSONL cover the active branch; JSON includes every branch. JSONL accepts
+// style=openai (default) or style=sharegpt.
+func ExportSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var s database.Session
+	err := database.DB.QueryRow(`
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, ''), created_at, updated_at
+		FROM sessions WHERE id = ?
+	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router, &s.CreatedAt, &s.UpdatedAt)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	var configs []database.ModelConfig
+	json.Unmarshal([]byte(s.ModelConfigs), &configs)
+	configs = normalizeModelConfigs(configs)
+
+	format := strings.ToLower(c.Query("format", "json"))
+	switch format {
+	case "json":
+		all, err := database.ListMessages(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if all == nil {
+			all = []database.Message{}
+		}
+		exp := services.BuildSessionExport(s, configs, all, database.GetActiveLeaf(id))
+		c.Attachment(exportFileName(s.Name, ".json"))
+		return c.JSON(exp)
+
+	case "markdown", "md":
+		branch, err := database.ListBranch(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Attachment(exportFileName(s.Name, ".md"))
+		c.Set("Content-Type", "text/markdown; charset=utf-8")
+		return c.SendString(services.RenderMarkdown(s.Name, configs, branch))
+
+	case "jsonl":
+		branch, err := database.ListBranch(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		data, err := services.RenderTrainingJSONL(services.ResolvePersonas(configs), branch, strings.ToLower(c.Query("style", "openai")))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Attachment(exportFileName(s.Name, ".jsonl"))
+		c.Set("Content-Type", "application/x-ndjson")
+		return c.Send(data)
+	}
+
+	return c.Status(400).JSON(fiber.Map{"error": "format must be markdown, json or jsonl"})
+}
+
+// ImportSession recreates a session from a JSON export, either posted as the
+// request body or uploaded as a multipart "file". All IDs are regenerated.
+func ImportSession(c *fiber.Ctx) error {
+	body := c.Body()
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Failed to read upload"})
+		}
+		defer file.Close()
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(file); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Failed to read upload"})
+		}
+		body = buf.Bytes()
+	}
+
+	var exp services.SessionExport
+	if err := json.Unmarshal(body, &exp); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid export file"})
+	}
+	if exp.Version < 1 || exp.Version > services.ExportVersion {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Unsupported export version: %d", exp.Version)})
+	}
+
+	if exp.Name == "" {
+		exp.Name = "Imported Session"
+	}
+	exp.ModelConfigs = normalizeModelConfigs(exp.ModelConfigs)
+	if exp.ModelConfigs == nil {
+		exp.ModelConfigs = []database.ModelConfig{}
+	}
+
+	turnTaking, err := turnTakingJSON(exp.TurnTaking)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	workflow, err := workflowJSON(exp.Workflow)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	debate, err := debateJSON(exp.Debate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	router, err := routerJSON(exp.Router)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Imported personas get new IDs like everything else, so an import never
+	// overwrites a local persona; model configs follow them to the new IDs
+	personaIDs := make(map[string]string, len(exp.Personas))
+	personas := make([]database.Persona, 0, len(exp.Personas))
+	for _, p := range exp.Personas {
+		if p.ID == "" {
+			continue
+		}
+		personaIDs[p.ID] = uuid.New().String()
+		p.ID = personaIDs[p.ID]
+		personas = append(personas, p)
+	}
+	for i := range exp.ModelConfigs {
+		if id, ok := personaIDs[exp.ModelConfigs[i].PersonaID]; ok {
+			exp.ModelConfigs[i].PersonaID = id
+		}
+	}
+
+	newID := uuid.New().String()
+	configsJSON, _ := json.Marshal(exp.ModelConfigs)
+	now := time.Now()
+	createdAt := exp.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	imported := database.SessionCopy{
+		Session: database.Session{
+			ID:                newID,
+			Name:              exp.Name,
+			ModelConfigs:      string(configsJSON),
+			AutonomyRounds:    exp.AutonomyRounds,
+			TurnTaking:        turnTaking,
+			Workflow:          workflow,
+			Debate:            debate,
+			ParallelResponses: exp.ParallelResponses,
+			Router:            router,
+			CreatedAt:         createdAt,
+			UpdatedAt:         now,
+		},
+		Personas: personas,
+	}
+
+	// Files are written before the transaction, so they are removed again
+	// if anything fails before it commits
+	attachmentIDs := make(map[string]string)
+	for _, a := range exp.Attachments {
+		data, err := base64.StdEncoding.DecodeString(a.Data)
+		if err != nil {
+			removeCopiedAttachments(imported)
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Invalid data for attachment %s", a.FileName)})
+		}
+		stored, err := services.WriteAttachmentFile(&newID, a.FileName, bytes.NewReader(data))
+		if err != nil {
+			removeCopiedAttachments(imported)
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Failed to import attachment %s: %v", a.FileName, err)})
+		}
+		attachmentIDs[a.ID] = stored.ID
+		imported.Attachments = append(imported.Attachments, *stored)
+	}
+
+	// Assign every new ID first so parents can be remapped in any order
+	messageIDs := make(map[string]string, len(exp.Messages))
+	for _, m := range exp.Messages {
+		messageIDs[m.ID] = uuid.New().String()
+	}
+
+	for _, m := range exp.Messages {
+		m.ID = messageIDs[m.ID]
+		m.SessionID = newID
+		if m.ParentID != nil {
+			if parent, ok := messageIDs[*m.ParentID]; ok {
+				m.ParentID = &parent
+			} else {
+				m.ParentID = nil
+			}
+		}
+
+		var attachments []string
+		for _, id := range m.Attachments {
+			if newAttachment, ok := attachmentIDs[id]; ok {
+				attachments = append(attachments, newAttachment)
+			}
+		}
+		m.Attachments = attachments
+
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = now
+		}
+		imported.Messages = append(imported.Messages, m)
+		leaf := m.ID
+		imported.ActiveLeaf = &leaf
+	}
+
+	if exp.ActiveLeafID != nil {
+		if leaf, ok := messageIDs[*exp.ActiveLeafID]; ok {
+			imported.ActiveLeaf = &leaf
+		}
+	}
+
+	if err := database.InsertSessionCopy(imported); err != nil {
+		removeCopiedAttachments(imported)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to import session"})
+	}
+
+	return sendSession(c, newID)
+}
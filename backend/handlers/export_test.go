@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+	"localai/services"
+)
+
+func importSession(t *testing.T, body string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Post("/api/sessions/import", ImportSession)
+	req := httptest.NewRequest("POST", "/api/sessions/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestImportSessionGivesPersonasNewIDs(t *testing.T) {
+	initTestDB(t)
+
+	if err := database.SavePersona(database.Persona{ID: "p1", Name: "Local", Prompt: "local prompt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	status := importSession(t, `{
+		"version": 1,
+		"name": "Imported",
+		"model_configs": [{"model_id": "m", "name": "M", "persona_id": "p1"}],
+		"personas": [{"id": "p1", "name": "Exported", "prompt": "exported prompt"}],
+		"messages": [{"id": "a", "role": "user", "content": "hi"}]
+	}`)
+	if status != 200 {
+		t.Fatalf("import status = %d", status)
+	}
+
+	if local, err := database.GetPersona("p1"); err != nil || local.Prompt != "local prompt" {
+		t.Errorf("local persona = %+v (%v), want it untouched", local, err)
+	}
+
+	var sessionID, configsJSON string
+	database.DB.QueryRow(`SELECT id, model_configs FROM sessions`).Scan(&sessionID, &configsJSON)
+	var configs []database.ModelConfig
+	json.Unmarshal([]byte(configsJSON), &configs)
+	if len(configs) != 1 || configs[0].PersonaID == "p1" {
+		t.Fatalf("imported configs = %+v, want a remapped persona ID", configs)
+	}
+	if p, err := database.GetPersona(configs[0].PersonaID); err != nil || p.Prompt != "exported prompt" {
+		t.Errorf("imported persona = %+v (%v), want the exported one", p, err)
+	}
+	if branch, err := database.ListBranch(sessionID); err != nil || len(branch) != 1 {
+		t.Errorf("imported branch = %+v (%v), want one message", branch, err)
+	}
+}
+
+func TestImportSessionFailureLeavesNothingBehind(t *testing.T) {
+	initTestDB(t)
+
+	status := importSession(t, `{
+		"version": 1,
+		"name": "Broken",
+		"attachments": [
+			{"id": "x1", "file_name": "ok.txt", "data": "aGVsbG8="},
+			{"id": "x2", "file_name": "bad.txt", "data": "not base64!"}
+		],
+		"messages": [{"id": "a", "role": "user", "content": "hi", "attachments": ["x1", "x2"]}]
+	}`)
+	if status != 400 {
+		t.Fatalf("import status = %d, want 400", status)
+	}
+
+	var sessions int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&sessions)
+	if sessions != 0 {
+		t.Errorf("%d sessions left after a failed import", sessions)
+	}
+	if files, _ := os.ReadDir(services.AttachmentsDir); len(files) != 0 {
+		t.Errorf("%d attachment files left after a failed import", len(files))
+	}
+}
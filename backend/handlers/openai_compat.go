@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"localai/database"
+	"localai/services"
+)
+
+type ChatCompletionRequest struct {
+	Model               string                  `json:"model"`
+	Messages            []ChatCompletionMessage `json:"messages"`
+	Stream              bool                    `json:"stream"`
+	Temperature         *float64                `json:"temperature,omitempty"`
+	TopP                *float64                `json:"top_p,omitempty"`
+	TopK                int                     `json:"top_k,omitempty"`
+	MaxTokens           int                     `json:"max_tokens,omitempty"`
+	MaxCompletionTokens int                     `json:"max_completion_tokens,omitempty"`
+	Stop                stringList              `json:"stop,omitempty"`
+	Seed                *int                    `json:"seed,omitempty"`
+}
+
+type ChatCompletionMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// toChatMessage accepts both string content and the content-part array used
+// for images. Images must be inline data URLs.
+func (m ChatCompletionMessage) toChatMessage() (services.ChatMessage, error) {
+	msg := services.ChatMessage{Role: m.Role}
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return msg, nil
+	}
+
+	if err := json.Unmarshal(m.Content, &msg.Content); err == nil {
+		return msg, nil
+	}
+
+	var parts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		ImageURL struct {
+			URL string `json:"url"`
+		} `json:"image_url"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return msg, fmt.Errorf("content must be a string or an array of content parts")
+	}
+
+	for _, p := range parts {
+		switch p.Type {
+		case "text":
+			msg.Parts = append(msg.Parts, services.ContentPart{Type: "text", Text: p.Text})
+		case "image_url":
+			header, data, ok := strings.Cut(p.ImageURL.URL, ";base64,")
+			if !ok || !strings.HasPrefix(header, "data:") {
+				return msg, fmt.Errorf("only base64 data URLs are supported for images")
+			}
+			msg.Parts = append(msg.Parts, services.ContentPart{
+				Type:     "image",
+				MimeType: strings.TrimPrefix(header, "data:"),
+				Data:     data,
+			})
+		}
+	}
+	msg.Content = msg.TextContent()
+	return msg, nil
+}
+
+// stringList accepts both a single string and an array, as OpenAI does for
+// stop sequences and embedding input.
+type stringList []string
+
+func (s *stringList) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*s = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+func (r ChatCompletionRequest) params() database.GenerationParams {
+	maxTokens := r.MaxCompletionTokens
+	if maxTokens == 0 {
+		maxTokens = r.MaxTokens
+	}
+	return database.GenerationParams{
+		Temperature: r.Temperature,
+		TopP:        r.TopP,
+		TopK:        r.TopK,
+		MaxTokens:   maxTokens,
+		Stop:        r.Stop,
+		Seed:        r.Seed,
+	}
+}
+
+type ChatCompletionChoice struct {
+	Index        int                   `json:"index"`
+	Message      *services.ChatMessage `json:"message,omitempty"`
+	Delta        *ChatCompletionDelta  `json:"delta,omitempty"`
+	FinishReason *string               `json:"finish_reason"`
+}
+
+type ChatCompletionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type ChatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   *ChatCompletionUsage   `json:"usage,omitempty"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+func openAIError(c *fiber.Ctx, status int, errType, message string) error {
+	return c.Status(status).JSON(fiber.Map{
+		"error": fiber.Map{
+			"message": message,
+			"type":    errType,
+		},
+	})
+}
+
+// upstreamError passes provider rate limits and auth failures through with
+// matching status codes so OpenAI clients can apply their own retry logic.
+func upstreamError(c *fiber.Ctx, err error) error {
+	pe, ok := services.AsProviderError(err)
+	if !ok {
+		return openAIError(c, 502, "api_error", err.Error())
+	}
+	switch pe.Kind {
+	case services.ErrRateLimit, services.ErrQuota:
+		if pe.RetryAfter > 0 {
+			c.Set("Retry-After", strconv.Itoa(int(pe.RetryAfter.Seconds()+0.5)))
+		}
+		return openAIError(c, 429, "rate_limit_error", pe.Message)
+	case services.ErrAuth:
+		return openAIError(c, 502, "authentication_error", pe.Message)
+	case services.ErrNotFound:
+		return openAIError(c, 404, "invalid_request_error", pe.Message)
+	case services.ErrInvalidRequest:
+		return openAIError(c, 400, "invalid_request_error", pe.Message)
+	}
+	return openAIError(c, 502, "api_error", pe.Message)
+}
+
+func ListOpenAIModels(c *fiber.Ctx) error {
+	models, err := services.ListAllModels()
+	if err != nil {
+		return openAIError(c, 503, "server_error", err.Error())
+	}
+
+	created := time.Now().Unix()
+	data := make([]OpenAIModel, len(models))
+	for i, m := range models {
+		data[i] = OpenAIModel{
+			ID:      m.ID,
+			Object:  "model",
+			Created: created,
+			OwnedBy: m.Provider,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"object": "list",
+		"data":   data,
+	})
+}
+
+func ChatCompletions(c *fiber.Ctx) error {
+	var req ChatCompletionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return openAIError(c, 400, "invalid_request_error", "Invalid request body")
+	}
+
+	if req.Model == "" {
+		return openAIError(c, 400, "invalid_request_error", "model is required")
+	}
+	if len(req.Messages) == 0 {
+		return openAIError(c, 400, "invalid_request_error", "messages must not be empty")
+	}
+
+	messages := make([]services.ChatMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		msg, err := m.toChatMessage()
+		if err != nil {
+			return openAIError(c, 400, "invalid_request_error", err.Error())
+		}
+		messages[i] = msg
+	}
+
+	if services.Providers.GetForModel(req.Model) == nil {
+		return openAIError(c, 404, "invalid_request_error", fmt.Sprintf("The model '%s' does not exist", req.Model))
+	}
+
+	id := "chatcmpl-" + uuid.New().String()
+	created := time.Now().Unix()
+
+	if req.Stream {
+		return streamChatCompletion(c, req, messages, id, created)
+	}
+
+	var content string
+	var totalTokens int
+	_, err := services.StreamChatToProvider(c.UserContext(), req.Model, messages, services.ChatOptions{Params: req.params()}, func(chunk string, done bool, tokens int) {
+		content += chunk
+		totalTokens = tokens
+	})
+	if err != nil {
+		return upstreamError(c, err)
+	}
+
+	finishReason := "stop"
+	return c.JSON(ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   req.Model,
+		Choices: []ChatCompletionChoice{{
+			Index:        0,
+			Message:      &services.ChatMessage{Role: "assistant", Content: content},
+			FinishReason: &finishReason,
+		}},
+		Usage: &ChatCompletionUsage{
+			CompletionTokens: totalTokens,
+			TotalTokens:      totalTokens,
+		},
+	})
+}
+
+func streamChatCompletion(c *fiber.Ctx, req ChatCompletionRequest, messages []services.ChatMessage, id string, created int64) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		writeEvent := func(v interface{}) {
+			data, _ := json.Marshal(v)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			if err := w.Flush(); err != nil {
+				// Client went away, stop generating
+				cancel()
+			}
+		}
+
+		chunkResponse := func(delta ChatCompletionDelta, finishReason *string) ChatCompletionResponse {
+			return ChatCompletionResponse{
+				ID:      id,
+				Object:  "chat.completion.chunk",
+				Created: created,
+				Model:   req.Model,
+				Choices: []ChatCompletionChoice{{
+					Index:        0,
+					Delta:        &delta,
+					FinishReason: finishReason,
+				}},
+			}
+		}
+
+		writeEvent(chunkResponse(ChatCompletionDelta{Role: "assistant"}, nil))
+
+		_, err := services.StreamChatToProvider(ctx, req.Model, messages, services.ChatOptions{Params: req.params()}, func(chunk string, done bool, tokens int) {
+			if chunk != "" {
+				writeEvent(chunkResponse(ChatCompletionDelta{Content: chunk}, nil))
+			}
+		})
+
+		if err != nil {
+			writeEvent(fiber.Map{
+				"error": fiber.Map{
+					"message": err.Error(),
+					"type":    "api_error",
+				},
+			})
+		} else {
+			finishReason := "stop"
+			writeEvent(chunkResponse(ChatCompletionDelta{}, &finishReason))
+		}
+
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		w.Flush()
+	})
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"localai/database"
+	"localai/services"
+)
+
+type PersonaRequest struct {
+	Name   *string                    `json:"name,omitempty"`
+	Prompt *string                    `json:"prompt,omitempty"`
+	Role   *string                    `json:"role,omitempty"`
+	Params *database.GenerationParams `json:"params,omitempty"`
+	Color  *string                    `json:"color,omitempty"`
+}
+
+// applyPersonaRequest copies the fields set in req onto p.
+func applyPersonaRequest(p *database.Persona, req PersonaRequest) error {
+	if req.Name != nil {
+		p.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Prompt != nil {
+		p.Prompt = strings.TrimSpace(*req.Prompt)
+	}
+	if req.Role != nil {
+		role := strings.TrimSpace(*req.Role)
+		if _, ok := services.LookupRole(role); role != "" && !ok {
+			return fmt.Errorf("unknown role: %s", role)
+		}
+		p.Role = role
+	}
+	if req.Params != nil {
+		p.Params = *req.Params
+	}
+	if req.Color != nil {
+		p.Color = *req.Color
+	}
+	if p.Name == "" {
+		return fmt.Errorf("persona needs a name")
+	}
+	return nil
+}
+
+func ListPersonas(c *fiber.Ctx) error {
+	personas, err := database.GetAllPersonas()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if personas == nil {
+		personas = []database.Persona{}
+	}
+	return c.JSON(personas)
+}
+
+func GetPersona(c *fiber.Ctx) error {
+	p, err := database.GetPersona(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Persona not found"})
+	}
+	return c.JSON(p)
+}
+
+func CreatePersona(c *fiber.Ctx) error {
+	var req PersonaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	p := database.Persona{ID: uuid.New().String()}
+	if err := applyPersonaRequest(&p, req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := database.SavePersona(p); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save persona"})
+	}
+
+	saved, err := database.GetPersona(p.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(saved)
+}
+
+func UpdatePersona(c *fiber.Ctx) error {
+	p, err := database.GetPersona(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Persona not found"})
+	}
+
+	var req PersonaRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := applyPersonaRequest(p, req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := database.SavePersona(*p); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save persona"})
+	}
+
+	saved, err := database.GetPersona(p.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(saved)
+}
+
+// DeletePersona removes a persona. Models that referenced it keep their own
+// settings and fall back to the general role.
+func DeletePersona(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if _, err := database.GetPersona(id); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Persona not found"})
+	}
+
+	if err := database.DeletePersona(id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete persona"})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Persona deleted"})
+}
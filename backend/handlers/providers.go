@@ -11,6 +11,8 @@ type ProviderInfo struct {
 	Configured bool     `json:"configured"`
 	Enabled    bool     `json:"enabled"`
 	Models     []string `json:"models"`
+	Custom     bool     `json:"custom,omitempty"`
+	BaseURL    string   `json:"base_url,omitempty"`
 }
 
 func ListProviders(c *fiber.Ctx) error {
@@ -65,6 +67,28 @@ func ListProviders(c *fiber.Ctx) error {
 	}
 	providers = append(providers, geminiInfo)
 
+	if customProviders, err := database.GetAllCustomProviders(); err == nil {
+		for _, cp := range customProviders {
+			models := cp.Models
+			if p := services.Providers.Get(cp.Name); p != nil && cp.AutoDiscover {
+				if discovered, err := p.ListModels(); err == nil {
+					models = make([]string, len(discovered))
+					for i, m := range discovered {
+						models[i] = m.Name
+					}
+				}
+			}
+			providers = append(providers, ProviderInfo{
+				Name:       cp.Name,
+				Configured: true,
+				Enabled:    cp.Enabled,
+				Models:     models,
+				Custom:     true,
+				BaseURL:    cp.BaseURL,
+			})
+		}
+	}
+
 	return c.JSON(providers)
 }
 
@@ -156,6 +180,15 @@ func ToggleProvider(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
 
+	if cp, err := database.GetCustomProvider(providerName); err == nil {
+		cp.Enabled = req.Enabled
+		if err := database.SaveCustomProvider(*cp); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to update provider"})
+		}
+		applyCustomProvider(*cp)
+		return c.JSON(fiber.Map{"status": "success", "enabled": req.Enabled})
+	}
+
 	if err := database.SetProviderEnabled(providerName, req.Enabled); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to update provider"})
 	}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+	"localai/services"
+)
+
+type RoleRequest struct {
+	Name         string   `json:"name"`
+	Description  *string  `json:"description,omitempty"`
+	Keywords     []string `json:"keywords"`
+	SystemPrompt *string  `json:"system_prompt,omitempty"`
+}
+
+type RoleResponse struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Keywords     []string `json:"keywords"`
+	SystemPrompt string   `json:"system_prompt"`
+	Builtin      bool     `json:"builtin"`
+}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func toRoleResponse(r database.Role) RoleResponse {
+	keywords := r.Keywords
+	if keywords == nil {
+		keywords = []string{}
+	}
+	return RoleResponse{
+		Name:         r.Name,
+		Description:  r.Description,
+		Keywords:     keywords,
+		SystemPrompt: r.SystemPrompt,
+		Builtin:      services.IsBuiltinRole(r.Name),
+	}
+}
+
+// cleanKeywords lowercases routing hints and drops blanks and duplicates.
+func cleanKeywords(keywords []string) []string {
+	seen := make(map[string]bool)
+	cleaned := []string{}
+	for _, kw := range keywords {
+		kw = strings.ToLower(strings.TrimSpace(kw))
+		if kw != "" && !seen[kw] {
+			seen[kw] = true
+			cleaned = append(cleaned, kw)
+		}
+	}
+	return cleaned
+}
+
+func ListRoles(c *fiber.Ctx) error {
+	roles := services.Roles()
+	result := make([]RoleResponse, len(roles))
+	for i, r := range roles {
+		result[i] = toRoleResponse(r)
+	}
+	return c.JSON(result)
+}
+
+func CreateRole(c *fiber.Ctx) error {
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if !roleNamePattern.MatchString(req.Name) {
+		return c.Status(400).JSON(fiber.Map{"error": "Name must contain only lowercase letters, digits, '-' and '_'"})
+	}
+	if services.IsBuiltinRole(req.Name) {
+		return c.Status(400).JSON(fiber.Map{"error": "Name conflicts with a built-in role"})
+	}
+	if _, err := database.GetRole(req.Name); err == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Role already exists"})
+	}
+
+	r := database.Role{
+		Name:     req.Name,
+		Keywords: cleanKeywords(req.Keywords),
+	}
+	if req.Description != nil {
+		r.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.SystemPrompt != nil {
+		r.SystemPrompt = strings.TrimSpace(*req.SystemPrompt)
+	}
+
+	if err := database.SaveRole(r); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save role"})
+	}
+
+	saved, err := database.GetRole(r.Name)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	services.SetCustomRole(*saved)
+
+	return c.JSON(toRoleResponse(*saved))
+}
+
+func UpdateRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	r, err := database.GetRole(name)
+	if err != nil {
+		if services.IsBuiltinRole(name) {
+			return c.Status(400).JSON(fiber.Map{"error": "Built-in roles cannot be changed"})
+		}
+		return c.Status(404).JSON(fiber.Map{"error": "Role not found"})
+	}
+
+	var req RoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Description != nil {
+		r.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Keywords != nil {
+		r.Keywords = cleanKeywords(req.Keywords)
+	}
+	if req.SystemPrompt != nil {
+		r.SystemPrompt = strings.TrimSpace(*req.SystemPrompt)
+	}
+
+	if err := database.SaveRole(*r); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save role"})
+	}
+	services.SetCustomRole(*r)
+
+	return c.JSON(toRoleResponse(*r))
+}
+
+func DeleteRole(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	if _, err := database.GetRole(name); err != nil {
+		if services.IsBuiltinRole(name) {
+			return c.Status(400).JSON(fiber.Map{"error": "Built-in roles cannot be deleted"})
+		}
+		return c.Status(404).JSON(fiber.Map{"error": "Role not found"})
+	}
+
+	if err := database.DeleteRole(name); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete role"})
+	}
+
+	services.RemoveCustomRole(name)
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Role deleted"})
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+)
+
+// parseSearchDate accepts either a plain date or an RFC 3339 timestamp. A
+// plain "to" date includes the whole day.
+func parseSearchDate(value string, endOfDay bool) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, true
+}
+
+func Search(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "q is required"})
+	}
+
+	from, ok := parseSearchDate(c.Query("from"), false)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "from must be YYYY-MM-DD or RFC 3339"})
+	}
+	to, ok := parseSearchDate(c.Query("to"), true)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "to must be YYYY-MM-DD or RFC 3339"})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 {
+		limit = 1
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	opts := database.SearchOptions{
+		Query: q,
+		Model: c.Query("model"),
+		From:  from,
+		To:    to,
+		Limit: limit,
+	}
+
+	messages, err := database.SearchMessages(opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	sessions := []database.SessionHit{}
+	if opts.Model == "" {
+		sessions, err = database.SearchSessions(opts)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"query":    q,
+		"sessions": sessions,
+		"messages": messages,
+	})
+}
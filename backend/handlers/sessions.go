@@ -2,23 +2,35 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"localai/database"
+	"localai/services"
 )
 
 type CreateSessionRequest struct {
 	Name           string                  `json:"name"`
 	ModelConfigs   []database.ModelConfig  `json:"model_configs"`
 	AutonomyRounds int                     `json:"autonomy_rounds"`
+	TurnTaking     *database.TurnTakingConfig `json:"turn_taking,omitempty"`
+	Workflow       *database.Workflow      `json:"workflow,omitempty"`
+	Debate         *database.DebateConfig  `json:"debate,omitempty"`
+	ParallelResponses bool                 `json:"parallel_responses"`
+	Router         *database.RouterConfig  `json:"router,omitempty"`
 }
 
 type UpdateSessionRequest struct {
 	Name           *string                 `json:"name,omitempty"`
 	ModelConfigs   []database.ModelConfig  `json:"model_configs,omitempty"`
 	AutonomyRounds *int                    `json:"autonomy_rounds,omitempty"`
+	TurnTaking     *database.TurnTakingConfig `json:"turn_taking,omitempty"`
+	Workflow       *database.Workflow      `json:"workflow,omitempty"`
+	Debate         *database.DebateConfig  `json:"debate,omitempty"`
+	ParallelResponses *bool                `json:"parallel_responses,omitempty"`
+	Router         *database.RouterConfig  `json:"router,omitempty"`
 }
 
 type SessionResponse struct {
@@ -26,6 +38,11 @@ type SessionResponse struct {
 	Name           string                  `json:"name"`
 	ModelConfigs   []database.ModelConfig  `json:"model_configs"`
 	AutonomyRounds int                     `json:"autonomy_rounds"`
+	TurnTaking     database.TurnTakingConfig `json:"turn_taking"`
+	Workflow       *database.Workflow      `json:"workflow,omitempty"`
+	Debate         *database.DebateConfig  `json:"debate,omitempty"`
+	ParallelResponses bool                 `json:"parallel_responses"`
+	Router         database.RouterConfig   `json:"router"`
 	CreatedAt      time.Time               `json:"created_at"`
 	UpdatedAt      time.Time               `json:"updated_at"`
 }
@@ -33,20 +50,133 @@ type SessionResponse struct {
 type SessionWithMessages struct {
 	SessionResponse
 	Messages []database.Message `json:"messages"`
+	Siblings map[string][]string `json:"siblings,omitempty"`
+}
+
+type CloneSessionRequest struct {
+	Name            string `json:"name"`
+	IncludeMessages bool   `json:"include_messages"`
+}
+
+type ForkSessionRequest struct {
+	MessageID string `json:"message_id"`
+	Name      string `json:"name"`
 }
 
 func normalizeModelConfigs(configs []database.ModelConfig) []database.ModelConfig {
 	for i := range configs {
-		if configs[i].Role == "" {
+		// Models with a persona take its role when they are loaded
+		if configs[i].Role == "" && configs[i].PersonaID == "" {
 			configs[i].Role = database.RoleGeneral
 		}
 	}
 	return configs
 }
 
+// turnTakingJSON validates a turn-taking setting and encodes it for the
+// turn_taking column.
+func turnTakingJSON(t *database.TurnTakingConfig) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+	if t.Mode == "" {
+		t.Mode = database.TurnTakingRoundRobin
+	}
+	if t.Mode != database.TurnTakingRoundRobin && t.Mode != database.TurnTakingModerator {
+		return "", fmt.Errorf("unknown turn-taking mode: %s", t.Mode)
+	}
+	data, _ := json.Marshal(t)
+	return string(data), nil
+}
+
+// routerJSON validates a router setting and encodes it for the router
+// column.
+func routerJSON(r *database.RouterConfig) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	if r.Mode == "" {
+		r.Mode = database.RouterKeyword
+	}
+	switch r.Mode {
+	case database.RouterKeyword:
+	case database.RouterModel:
+		if r.Model == "" {
+			return "", fmt.Errorf("model routing needs a model")
+		}
+	default:
+		return "", fmt.Errorf("unknown router mode: %s", r.Mode)
+	}
+	if r.MinConfidence < 0 || r.MinConfidence > 1 {
+		return "", fmt.Errorf("min_confidence must be between 0 and 1")
+	}
+	data, _ := json.Marshal(r)
+	return string(data), nil
+}
+
+// workflowJSON validates a workflow and encodes it for the workflow column.
+// A workflow without stages is stored as none.
+func workflowJSON(w *database.Workflow) (string, error) {
+	if w == nil || len(w.Stages) == 0 {
+		return "", nil
+	}
+	for i := range w.Stages {
+		if w.Stages[i].ShortID == "" && w.Stages[i].Role == "" {
+			w.Stages[i].Role = database.RoleGeneral
+		}
+	}
+	if err := services.ValidateWorkflow(*w); err != nil {
+		return "", err
+	}
+	data, _ := json.Marshal(w)
+	return string(data), nil
+}
+
+// maxCritiqueRounds bounds how many critique rounds a debate may run.
+const maxCritiqueRounds = 10
+
+// debateJSON validates a debate setting and encodes it for the debate
+// column. A setting without a mode turns debating off.
+func debateJSON(d *database.DebateConfig) (string, error) {
+	if d == nil || d.Mode == "" {
+		return "", nil
+	}
+	if d.Mode != database.DebateModeJudge && d.Mode != database.DebateModeVote {
+		return "", fmt.Errorf("unknown debate mode: %s", d.Mode)
+	}
+	if d.CritiqueRounds < 0 {
+		d.CritiqueRounds = 0
+	}
+	if d.CritiqueRounds > maxCritiqueRounds {
+		d.CritiqueRounds = maxCritiqueRounds
+	}
+	data, _ := json.Marshal(d)
+	return string(data), nil
+}
+
+// debateResponse decodes the debate column for API responses, leaving it
+// out when the session does not debate.
+func debateResponse(raw string) *database.DebateConfig {
+	d := database.ParseDebate(raw)
+	if d.Mode == "" {
+		return nil
+	}
+	return &d
+}
+
+// workflowResponse decodes the workflow column for API responses, leaving
+// it out when the session has none.
+func workflowResponse(raw string) *database.Workflow {
+	w := database.ParseWorkflow(raw)
+	if len(w.Stages) == 0 {
+		return nil
+	}
+	return &w
+}
+
 func ListSessions(c *fiber.Ctx) error {
 	rows, err := database.DB.Query(`
-		SELECT id, name, model_configs, autonomy_rounds, created_at, updated_at
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, ''), created_at, updated_at
 		FROM sessions
 		ORDER BY updated_at DESC
 	`)
@@ -58,7 +188,7 @@ func ListSessions(c *fiber.Ctx) error {
 	var sessions []SessionResponse
 	for rows.Next() {
 		var s database.Session
-		if err := rows.Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router, &s.CreatedAt, &s.UpdatedAt); err != nil {
 			continue
 		}
 
@@ -71,6 +201,11 @@ func ListSessions(c *fiber.Ctx) error {
 			Name:           s.Name,
 			ModelConfigs:   configs,
 			AutonomyRounds: s.AutonomyRounds,
+			TurnTaking:     database.ParseTurnTaking(s.TurnTaking),
+			Workflow:       workflowResponse(s.Workflow),
+			Debate:         debateResponse(s.Debate),
+			ParallelResponses: s.ParallelResponses,
+			Router:         database.ParseRouter(s.Router),
 			CreatedAt:      s.CreatedAt,
 			UpdatedAt:      s.UpdatedAt,
 		})
@@ -92,23 +227,19 @@ func CreateSession(c *fiber.Ctx) error {
 	if req.Name == "" {
 		req.Name = "New Session"
 	}
-	if req.AutonomyRounds < 0 {
-		req.AutonomyRounds = 0
-	}
-	if req.AutonomyRounds > 999 {
-		req.AutonomyRounds = 999
-	}
 
-	req.ModelConfigs = normalizeModelConfigs(req.ModelConfigs)
+	settings, err := sessionSettings(&req)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	id := uuid.New().String()
-	configsJSON, _ := json.Marshal(req.ModelConfigs)
 	now := time.Now()
 
-	_, err := database.DB.Exec(`
-		INSERT INTO sessions (id, name, model_configs, autonomy_rounds, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, id, req.Name, string(configsJSON), req.AutonomyRounds, now, now)
+	_, err = database.DB.Exec(`
+		INSERT INTO sessions (id, name, model_configs, autonomy_rounds, turn_taking, workflow, debate, parallel_responses, router, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, req.Name, settings.ModelConfigs, settings.AutonomyRounds, settings.TurnTaking, settings.Workflow, settings.Debate, settings.ParallelResponses, settings.Router, now, now)
 
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -118,20 +249,69 @@ func CreateSession(c *fiber.Ctx) error {
 		ID:             id,
 		Name:           req.Name,
 		ModelConfigs:   req.ModelConfigs,
-		AutonomyRounds: req.AutonomyRounds,
+		AutonomyRounds: settings.AutonomyRounds,
+		TurnTaking:     database.ParseTurnTaking(settings.TurnTaking),
+		Workflow:       workflowResponse(settings.Workflow),
+		Debate:         debateResponse(settings.Debate),
+		ParallelResponses: settings.ParallelResponses,
+		Router:         database.ParseRouter(settings.Router),
 		CreatedAt:      now,
 		UpdatedAt:      now,
 	})
 }
 
+// sessionSettings validates the settings of a new session or template and
+// encodes them as the sessions table stores them.
+func sessionSettings(req *CreateSessionRequest) (database.Session, error) {
+	if req.AutonomyRounds < 0 {
+		req.AutonomyRounds = 0
+	}
+	if req.AutonomyRounds > 999 {
+		req.AutonomyRounds = 999
+	}
+
+	req.ModelConfigs = normalizeModelConfigs(req.ModelConfigs)
+	turnTaking, err := turnTakingJSON(req.TurnTaking)
+	if err != nil {
+		return database.Session{}, err
+	}
+	workflow, err := workflowJSON(req.Workflow)
+	if err != nil {
+		return database.Session{}, err
+	}
+	debate, err := debateJSON(req.Debate)
+	if err != nil {
+		return database.Session{}, err
+	}
+	router, err := routerJSON(req.Router)
+	if err != nil {
+		return database.Session{}, err
+	}
+
+	configsJSON, _ := json.Marshal(req.ModelConfigs)
+	return database.Session{
+		ModelConfigs:      string(configsJSON),
+		AutonomyRounds:    req.AutonomyRounds,
+		TurnTaking:        turnTaking,
+		Workflow:          workflow,
+		Debate:            debate,
+		ParallelResponses: req.ParallelResponses,
+		Router:            router,
+	}, nil
+}
+
+
 func GetSession(c *fiber.Ctx) error {
-	id := c.Params("id")
+	return sendSession(c, c.Params("id"))
+}
 
+// sendSession responds with a session and the messages on its active branch.
+func sendSession(c *fiber.Ctx, id string) error {
 	var s database.Session
 	err := database.DB.QueryRow(`
-		SELECT id, name, model_configs, autonomy_rounds, created_at, updated_at
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, ''), created_at, updated_at
 		FROM sessions WHERE id = ?
-	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.CreatedAt, &s.UpdatedAt)
+	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router, &s.CreatedAt, &s.UpdatedAt)
 
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
@@ -141,22 +321,14 @@ func GetSession(c *fiber.Ctx) error {
 	json.Unmarshal([]byte(s.ModelConfigs), &configs)
 	configs = normalizeModelConfigs(configs)
 
-	rows, err := database.DB.Query(`
-		SELECT id, session_id, role, model_id, model_name, content, round_number, tokens_used, created_at
-		FROM messages WHERE session_id = ? ORDER BY created_at
-	`, id)
+	all, err := database.ListMessages(id)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
-	defer rows.Close()
 
-	var messages []database.Message
-	for rows.Next() {
-		var m database.Message
-		if err := rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.ModelID, &m.ModelName, &m.Content, &m.RoundNumber, &m.TokensUsed, &m.CreatedAt); err != nil {
-			continue
-		}
-		messages = append(messages, m)
+	messages, err := database.ListBranch(id)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	if messages == nil {
@@ -169,13 +341,44 @@ func GetSession(c *fiber.Ctx) error {
 			Name:           s.Name,
 			ModelConfigs:   configs,
 			AutonomyRounds: s.AutonomyRounds,
+			TurnTaking:     database.ParseTurnTaking(s.TurnTaking),
+			Workflow:       workflowResponse(s.Workflow),
+			Debate:         debateResponse(s.Debate),
+			ParallelResponses: s.ParallelResponses,
+			Router:         database.ParseRouter(s.Router),
 			CreatedAt:      s.CreatedAt,
 			UpdatedAt:      s.UpdatedAt,
 		},
 		Messages: messages,
+		Siblings: branchSiblings(all, messages),
 	})
 }
 
+// branchSiblings lists, for each message on the branch that has alternatives,
+// the IDs of all messages sharing its parent in creation order.
+func branchSiblings(all, branch []database.Message) map[string][]string {
+	groups := make(map[string][]string)
+	for _, m := range all {
+		parent := ""
+		if m.ParentID != nil {
+			parent = *m.ParentID
+		}
+		groups[parent] = append(groups[parent], m.ID)
+	}
+
+	siblings := make(map[string][]string)
+	for _, m := range branch {
+		parent := ""
+		if m.ParentID != nil {
+			parent = *m.ParentID
+		}
+		if len(groups[parent]) > 1 {
+			siblings[m.ID] = groups[parent]
+		}
+	}
+	return siblings
+}
+
 func UpdateSession(c *fiber.Ctx) error {
 	id := c.Params("id")
 
@@ -190,6 +393,23 @@ func UpdateSession(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
 	}
 
+	turnTaking, err := turnTakingJSON(req.TurnTaking)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	workflow, err := workflowJSON(req.Workflow)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	debate, err := debateJSON(req.Debate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	router, err := routerJSON(req.Router)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	now := time.Now()
 
 	if req.Name != nil {
@@ -210,6 +430,21 @@ func UpdateSession(c *fiber.Ctx) error {
 		}
 		database.DB.Exec("UPDATE sessions SET autonomy_rounds = ?, updated_at = ? WHERE id = ?", rounds, now, id)
 	}
+	if req.TurnTaking != nil {
+		database.DB.Exec("UPDATE sessions SET turn_taking = ?, updated_at = ? WHERE id = ?", turnTaking, now, id)
+	}
+	if req.Workflow != nil {
+		database.DB.Exec("UPDATE sessions SET workflow = ?, updated_at = ? WHERE id = ?", workflow, now, id)
+	}
+	if req.Debate != nil {
+		database.DB.Exec("UPDATE sessions SET debate = ?, updated_at = ? WHERE id = ?", debate, now, id)
+	}
+	if req.ParallelResponses != nil {
+		database.DB.Exec("UPDATE sessions SET parallel_responses = ?, updated_at = ? WHERE id = ?", *req.ParallelResponses, now, id)
+	}
+	if req.Router != nil {
+		database.DB.Exec("UPDATE sessions SET router = ?, updated_at = ? WHERE id = ?", router, now, id)
+	}
 
 	return GetSession(c)
 }
@@ -218,6 +453,13 @@ func DeleteSession(c *fiber.Ctx) error {
 	id := c.Params("id")
 
 	database.DB.Exec("DELETE FROM messages WHERE session_id = ?", id)
+	database.DeleteSessionDocuments(id)
+
+	if attachments, err := database.ListSessionAttachments(id); err == nil {
+		for i := range attachments {
+			services.RemoveAttachment(&attachments[i])
+		}
+	}
 
 	result, err := database.DB.Exec("DELETE FROM sessions WHERE id = ?", id)
 	if err != nil {
@@ -231,3 +473,272 @@ func DeleteSession(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"status": "deleted"})
 }
+
+// PinMessage marks a message that context compaction must never drop.
+func PinMessage(c *fiber.Ctx) error {
+	sessionID := c.Params("id")
+	messageID := c.Params("messageId")
+
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	found, err := database.SetMessagePinned(sessionID, messageID, req.Pinned)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !found {
+		return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
+	}
+
+	orchMu.RLock()
+	orch := orchestrators[sessionID]
+	orchMu.RUnlock()
+	if orch != nil {
+		orch.SetPinned(messageID, req.Pinned)
+	}
+
+	return c.JSON(fiber.Map{"id": messageID, "pinned": req.Pinned})
+}
+
+// SwitchBranch makes the branch through the given message active, landing
+// on its newest descendant.
+func SwitchBranch(c *fiber.Ctx) error {
+	sessionID := c.Params("id")
+
+	var req struct {
+		MessageID string `json:"message_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if _, err := database.GetMessage(sessionID, req.MessageID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
+	}
+
+	all, err := database.ListMessages(sessionID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	leaf := database.LatestLeaf(all, req.MessageID)
+	if err := database.SetActiveLeaf(sessionID, leaf); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	orchMu.RLock()
+	orch := orchestrators[sessionID]
+	orchMu.RUnlock()
+	if orch != nil {
+		orch.LoadHistory(database.PathTo(all, leaf))
+	}
+
+	return GetSession(c)
+}
+
+// ForkSession copies the conversation up to a message, with its attachments
+// and the session's indexed documents, into a new session, leaving the
+// original untouched. The copy is all or nothing.
+func ForkSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req ForkSessionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var s database.Session
+	err := database.DB.QueryRow(`
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, '') FROM sessions WHERE id = ?
+	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	var path []database.Message
+	if req.MessageID != "" {
+		if _, err := database.GetMessage(id, req.MessageID); err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Message not found"})
+		}
+		all, err := database.ListMessages(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		path = database.PathTo(all, req.MessageID)
+	} else {
+		path, err = database.ListBranch(id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	if req.Name == "" {
+		req.Name = s.Name + " (fork)"
+	}
+
+	now := time.Now()
+	s.ID = uuid.New().String()
+	s.Name = req.Name
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	fork := database.SessionCopy{Session: s}
+
+	if _, err := copySessionContent(id, path, &fork); err != nil {
+		removeCopiedAttachments(fork)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fork session: " + err.Error()})
+	}
+	if err := database.InsertSessionCopy(fork); err != nil {
+		removeCopiedAttachments(fork)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fork session: " + err.Error()})
+	}
+
+	return sendSession(c, s.ID)
+}
+
+// CloneSession copies a session's settings and, when asked, every message on
+// all of its branches together with their attachments and the session's
+// indexed documents. The copy is all or nothing.
+func CloneSession(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req CloneSessionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var s database.Session
+	err := database.DB.QueryRow(`
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, '') FROM sessions WHERE id = ?
+	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if req.Name == "" {
+		req.Name = s.Name + " (copy)"
+	}
+
+	now := time.Now()
+	s.ID = uuid.New().String()
+	s.Name = req.Name
+	s.CreatedAt = now
+	s.UpdatedAt = now
+	clone := database.SessionCopy{Session: s}
+
+	if req.IncludeMessages {
+		err = cloneMessages(id, &clone)
+	}
+	if err == nil {
+		err = database.InsertSessionCopy(clone)
+	}
+	if err != nil {
+		removeCopiedAttachments(clone)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to copy session: " + err.Error()})
+	}
+
+	return sendSession(c, s.ID)
+}
+
+// cloneMessages copies every message on all of the session's branches into
+// clone and keeps the same branch active.
+func cloneMessages(id string, clone *database.SessionCopy) error {
+	messages, err := database.ListMessages(id)
+	if err != nil {
+		return err
+	}
+	messageIDs, err := copySessionContent(id, messages, clone)
+	if err != nil {
+		return err
+	}
+	if leaf := database.GetActiveLeaf(id); leaf != nil {
+		if newLeaf, ok := messageIDs[*leaf]; ok {
+			clone.ActiveLeaf = &newLeaf
+		}
+	}
+	return nil
+}
+
+// removeCopiedAttachments deletes the attachment files copied for a session
+// copy that was never saved.
+func removeCopiedAttachments(c database.SessionCopy) {
+	for i := range c.Attachments {
+		services.RemoveAttachment(&c.Attachments[i])
+	}
+}
+
+// copySessionContent fills clone with copies of the given messages of a
+// session and all of its indexed documents, remapped to new IDs. The newest
+// copied message becomes the active leaf. Attachment files are copied as it
+// goes and listed in clone even when an error is returned. It returns the
+// new ID of every copied message.
+func copySessionContent(id string, messages []database.Message, clone *database.SessionCopy) (map[string]string, error) {
+	newID := clone.Session.ID
+
+	// Assign every new ID first so parents can be remapped in any order
+	messageIDs := make(map[string]string, len(messages))
+	for _, m := range messages {
+		messageIDs[m.ID] = uuid.New().String()
+	}
+
+	attachmentIDs := make(map[string]string)
+	for _, m := range messages {
+		m.ID = messageIDs[m.ID]
+		m.SessionID = newID
+		if m.ParentID != nil {
+			if parent, ok := messageIDs[*m.ParentID]; ok {
+				m.ParentID = &parent
+			} else {
+				m.ParentID = nil
+			}
+		}
+
+		var attachments []string
+		for _, attachmentID := range m.Attachments {
+			if _, ok := attachmentIDs[attachmentID]; !ok {
+				copied, err := services.CopyAttachmentFile(attachmentID, &newID)
+				if err != nil {
+					return nil, err
+				}
+				clone.Attachments = append(clone.Attachments, *copied)
+				attachmentIDs[attachmentID] = copied.ID
+			}
+			attachments = append(attachments, attachmentIDs[attachmentID])
+		}
+		m.Attachments = attachments
+
+		clone.Messages = append(clone.Messages, m)
+		leaf := m.ID
+		clone.ActiveLeaf = &leaf
+	}
+
+	documents, err := database.ListDocuments(id)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := database.ListSessionChunks(id)
+	if err != nil {
+		return nil, err
+	}
+
+	documentIDs := make(map[string]string, len(documents))
+	for _, d := range documents {
+		documentIDs[d.ID] = uuid.New().String()
+		d.ID = documentIDs[d.ID]
+		d.SessionID = newID
+		clone.Documents = append(clone.Documents, d)
+	}
+	clone.Chunks = make(map[string][]database.DocumentChunk, len(documents))
+	for _, chunk := range chunks {
+		documentID, ok := documentIDs[chunk.DocumentID]
+		if !ok {
+			continue
+		}
+		chunk.DocumentID = documentID
+		chunk.SessionID = newID
+		clone.Chunks[documentID] = append(clone.Chunks[documentID], chunk)
+	}
+
+	return messageIDs, nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"localai/database"
+)
+
+// initTestDB initialises the database in a temporary working directory.
+func initTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+func TestForkSessionCopiesAncestorsAndDocuments(t *testing.T) {
+	initTestDB(t)
+
+	now := time.Now()
+	if _, err := database.DB.Exec(`INSERT INTO sessions (id, name, model_configs, created_at, updated_at) VALUES ('s1', 'Original', '[]', ?, ?)`, now, now); err != nil {
+		t.Fatal(err)
+	}
+	parent := func(id string) *string { return &id }
+	for i, m := range []database.Message{
+		{ID: "m1", Role: "user", Content: "first"},
+		{ID: "m2", ParentID: parent("m1"), Role: "user", Content: "second"},
+		{ID: "m3", ParentID: parent("m2"), Role: "user", Content: "third"},
+	} {
+		m.SessionID = "s1"
+		m.CreatedAt = now.Add(time.Duration(i) * time.Second)
+		if err := database.InsertMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := database.Document{ID: "d1", SessionID: "s1", FileName: "notes.txt", EmbeddingModel: "e", CreatedAt: now}
+	if err := database.SaveDocument(doc, []database.DocumentChunk{{Content: "chunk", Embedding: []float32{1}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Post("/api/sessions/:id/fork", ForkSession)
+	req := httptest.NewRequest("POST", "/api/sessions/s1/fork", strings.NewReader(`{"message_id":"m2"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("fork failed: %v %v", resp.StatusCode, err)
+	}
+
+	var forkID string
+	database.DB.QueryRow(`SELECT id FROM sessions WHERE id != 's1'`).Scan(&forkID)
+	branch, err := database.ListBranch(forkID)
+	if err != nil || len(branch) != 2 || branch[0].Content != "first" || branch[1].Content != "second" {
+		t.Errorf("fork branch = %+v (%v), want first and second", branch, err)
+	}
+	if leaf := database.GetActiveLeaf(forkID); leaf == nil || *leaf != branch[len(branch)-1].ID {
+		t.Errorf("fork active leaf = %v", leaf)
+	}
+	chunks, err := database.ListSessionChunks(forkID)
+	if err != nil || len(chunks) != 1 || chunks[0].FileName != "notes.txt" {
+		t.Errorf("fork chunks = %+v (%v), want the copied document", chunks, err)
+	}
+}
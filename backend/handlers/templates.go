@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"localai/database"
+)
+
+type CreateTemplateRequest struct {
+	CreateSessionRequest
+	Description string `json:"description"`
+}
+
+type SaveTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type TemplateSessionRequest struct {
+	Name string `json:"name"`
+}
+
+type TemplateResponse struct {
+	ID                string                    `json:"id"`
+	Name              string                    `json:"name"`
+	Description       string                    `json:"description"`
+	ModelConfigs      []database.ModelConfig    `json:"model_configs"`
+	AutonomyRounds    int                       `json:"autonomy_rounds"`
+	TurnTaking        database.TurnTakingConfig `json:"turn_taking"`
+	Workflow          *database.Workflow        `json:"workflow,omitempty"`
+	Debate            *database.DebateConfig    `json:"debate,omitempty"`
+	ParallelResponses bool                      `json:"parallel_responses"`
+	Router            database.RouterConfig     `json:"router"`
+	CreatedAt         time.Time                 `json:"created_at"`
+	UpdatedAt         time.Time                 `json:"updated_at"`
+}
+
+func toTemplateResponse(t database.SessionTemplate) TemplateResponse {
+	var configs []database.ModelConfig
+	json.Unmarshal([]byte(t.ModelConfigs), &configs)
+	if configs == nil {
+		configs = []database.ModelConfig{}
+	}
+	return TemplateResponse{
+		ID:                t.ID,
+		Name:              t.Name,
+		Description:       t.Description,
+		ModelConfigs:      normalizeModelConfigs(configs),
+		AutonomyRounds:    t.AutonomyRounds,
+		TurnTaking:        database.ParseTurnTaking(t.TurnTaking),
+		Workflow:          workflowResponse(t.Workflow),
+		Debate:            debateResponse(t.Debate),
+		ParallelResponses: t.ParallelResponses,
+		Router:            database.ParseRouter(t.Router),
+		CreatedAt:         t.CreatedAt,
+		UpdatedAt:         t.UpdatedAt,
+	}
+}
+
+func ListTemplates(c *fiber.Ctx) error {
+	templates, err := database.ListTemplates()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	result := make([]TemplateResponse, len(templates))
+	for i, t := range templates {
+		result[i] = toTemplateResponse(t)
+	}
+	return c.JSON(result)
+}
+
+func GetTemplate(c *fiber.Ctx) error {
+	t, err := database.GetTemplate(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+	}
+	return c.JSON(toTemplateResponse(*t))
+}
+
+func CreateTemplate(c *fiber.Ctx) error {
+	var req CreateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Template needs a name"})
+	}
+
+	settings, err := sessionSettings(&req.CreateSessionRequest)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return saveTemplate(c, req.Name, req.Description, settings)
+}
+
+// SaveSessionAsTemplate stores an existing session's settings as a template.
+func SaveSessionAsTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	var req SaveTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	var s database.Session
+	err := database.DB.QueryRow(`
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, '') FROM sessions WHERE id = ?
+	`, id).Scan(&s.ID, &s.Name, &s.ModelConfigs, &s.AutonomyRounds, &s.TurnTaking, &s.Workflow, &s.Debate, &s.ParallelResponses, &s.Router)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if req.Name == "" {
+		req.Name = s.Name
+	}
+
+	return saveTemplate(c, req.Name, req.Description, s)
+}
+
+func saveTemplate(c *fiber.Ctx, name, description string, settings database.Session) error {
+	now := time.Now()
+	t := database.SessionTemplate{
+		ID:                uuid.New().String(),
+		Name:              name,
+		Description:       description,
+		ModelConfigs:      settings.ModelConfigs,
+		AutonomyRounds:    settings.AutonomyRounds,
+		TurnTaking:        settings.TurnTaking,
+		Workflow:          settings.Workflow,
+		Debate:            settings.Debate,
+		ParallelResponses: settings.ParallelResponses,
+		Router:            settings.Router,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := database.InsertTemplate(t); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save template"})
+	}
+	return c.JSON(toTemplateResponse(t))
+}
+
+func DeleteTemplate(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	if _, err := database.GetTemplate(id); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+	}
+
+	if err := database.DeleteTemplate(id); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete template"})
+	}
+
+	return c.JSON(fiber.Map{"status": "success", "message": "Template deleted"})
+}
+
+// CreateSessionFromTemplate starts a new session with a template's settings.
+func CreateSessionFromTemplate(c *fiber.Ctx) error {
+	t, err := database.GetTemplate(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Template not found"})
+	}
+
+	var req TemplateSessionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.Name == "" {
+		req.Name = t.Name
+	}
+
+	id := uuid.New().String()
+	now := time.Now()
+	_, err = database.DB.Exec(`
+		INSERT INTO sessions (id, name, model_configs, autonomy_rounds, turn_taking, workflow, debate, parallel_responses, router, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, id, req.Name, t.ModelConfigs, t.AutonomyRounds, t.TurnTaking, t.Workflow, t.Debate, t.ParallelResponses, t.Router, now, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return sendSession(c, id)
+}
@@ -0,0 +1,10 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"localai/services"
+)
+
+func ListTools(c *fiber.Ctx) error {
+	return c.JSON(services.Tools.ListAll())
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -18,6 +20,8 @@ type ClientMessage struct {
 	Type           string   `json:"type"`
 	Content        string   `json:"content,omitempty"`
 	MentionedModels []string `json:"mentioned_models,omitempty"`
+	Attachments    []string `json:"attachments,omitempty"`
+	MessageID      string   `json:"message_id,omitempty"`
 }
 
 type SafeConn struct {
@@ -44,6 +48,17 @@ var (
 	orchMu        sync.RWMutex
 )
 
+// maxToolSteps bounds how many rounds of tool calls a single response may make.
+const maxToolSteps = 8
+
+// maxMentionDepth bounds how long a chain of models handing over to each
+// other with @mentions may grow, and maxMentionHandoffs how many hand-offs
+// one user message may trigger in total.
+const (
+	maxMentionDepth    = 3
+	maxMentionHandoffs = 8
+)
+
 func WebSocketHandler(c *websocket.Conn) {
 	sessionID := c.Params("sessionId")
 	log.Printf("WebSocket connected for session: %s", sessionID)
@@ -52,8 +67,8 @@ func WebSocketHandler(c *websocket.Conn) {
 
 	var session database.Session
 	err := database.DB.QueryRow(`
-		SELECT id, name, model_configs, autonomy_rounds FROM sessions WHERE id = ?
-	`, sessionID).Scan(&session.ID, &session.Name, &session.ModelConfigs, &session.AutonomyRounds)
+		SELECT id, name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, '') FROM sessions WHERE id = ?
+	`, sessionID).Scan(&session.ID, &session.Name, &session.ModelConfigs, &session.AutonomyRounds, &session.TurnTaking, &session.Workflow, &session.Debate, &session.ParallelResponses, &session.Router)
 
 	if err != nil {
 		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Session not found"})
@@ -63,22 +78,17 @@ func WebSocketHandler(c *websocket.Conn) {
 
 	var modelConfigs []database.ModelConfig
 	json.Unmarshal([]byte(session.ModelConfigs), &modelConfigs)
-	modelConfigs = normalizeModelConfigs(modelConfigs)
+	modelConfigs = services.ResolvePersonas(normalizeModelConfigs(modelConfigs))
 
 	orch := services.NewOrchestrator(sessionID, modelConfigs, session.AutonomyRounds)
-
-	rows, _ := database.DB.Query(`
-		SELECT id, session_id, role, model_id, model_name, content, round_number, tokens_used, created_at
-		FROM messages WHERE session_id = ? ORDER BY created_at
-	`, sessionID)
-	if rows != nil {
-		var messages []database.Message
-		for rows.Next() {
-			var m database.Message
-			rows.Scan(&m.ID, &m.SessionID, &m.Role, &m.ModelID, &m.ModelName, &m.Content, &m.RoundNumber, &m.TokensUsed, &m.CreatedAt)
-			messages = append(messages, m)
-		}
-		rows.Close()
+	orch.SessionName = session.Name
+	orch.TurnTaking = database.ParseTurnTaking(session.TurnTaking)
+	orch.Workflow = database.ParseWorkflow(session.Workflow)
+	orch.Debate = database.ParseDebate(session.Debate)
+	orch.ParallelResponses = session.ParallelResponses
+	orch.Router = database.ParseRouter(session.Router)
+
+	if messages, err := database.ListBranch(sessionID); err == nil {
 		orch.LoadHistory(messages)
 	}
 
@@ -104,7 +114,13 @@ func WebSocketHandler(c *websocket.Conn) {
 
 		switch msg.Type {
 		case "user_message":
-			go handleUserMessage(sc, orch, sessionID, msg.Content, msg.MentionedModels)
+			go handleUserMessage(sc, orch, sessionID, msg.Content, msg.MentionedModels, msg.Attachments)
+
+		case "edit_message":
+			go handleEditMessage(sc, orch, sessionID, msg.MessageID, msg.Content, msg.MentionedModels, msg.Attachments)
+
+		case "regenerate":
+			go handleRegenerate(sc, orch, sessionID, msg.MessageID)
 
 		case "pause":
 			orch.Pause()
@@ -119,49 +135,100 @@ func WebSocketHandler(c *websocket.Conn) {
 			sc.WriteJSON(services.StreamMessage{Type: "stopped"})
 
 		case "update_config":
-			var configsJSON string
+			var name, configsJSON, turnTaking, workflow, debate, router string
 			var rounds int
-			database.DB.QueryRow("SELECT model_configs, autonomy_rounds FROM sessions WHERE id = ?", sessionID).Scan(&configsJSON, &rounds)
+			var parallel bool
+			database.DB.QueryRow("SELECT name, model_configs, autonomy_rounds, COALESCE(turn_taking, ''), COALESCE(workflow, ''), COALESCE(debate, ''), COALESCE(parallel_responses, 0), COALESCE(router, '') FROM sessions WHERE id = ?", sessionID).Scan(&name, &configsJSON, &rounds, &turnTaking, &workflow, &debate, &parallel, &router)
 			var configs []database.ModelConfig
 			json.Unmarshal([]byte(configsJSON), &configs)
-			configs = normalizeModelConfigs(configs)
-			orch.ModelConfigs = configs
-			orch.AutonomyRounds = rounds
+			configs = services.ResolvePersonas(normalizeModelConfigs(configs))
+			orch.UpdateConfig(services.SessionConfig{
+				Name:              name,
+				ModelConfigs:      configs,
+				AutonomyRounds:    rounds,
+				TurnTaking:        database.ParseTurnTaking(turnTaking),
+				Workflow:          database.ParseWorkflow(workflow),
+				Debate:            database.ParseDebate(debate),
+				ParallelResponses: parallel,
+				Router:            database.ParseRouter(router),
+			})
 		}
 	}
 }
 
-func handleUserMessage(sc *SafeConn, orch *services.Orchestrator, sessionID, content string, mentionedModels []string) {
-	orch.Reset()
+func handleUserMessage(sc *SafeConn, orch *services.Orchestrator, sessionID, content string, mentionedModels, attachments []string) {
+	if err := checkSessionAttachments(sessionID, attachments); err != nil {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: err.Error()})
+		return
+	}
 
-	userMsgID := uuid.New().String()
-	now := time.Now()
-	database.DB.Exec(`
-		INSERT INTO messages (id, session_id, role, content, round_number, tokens_used, created_at)
-		VALUES (?, ?, 'user', ?, 0, 0, ?)
-	`, userMsgID, sessionID, content, now)
+	end := orch.Begin()
+	defer end()
 
+	respondToUserMessage(sc, orch, sessionID, content, mentionedModels, attachments)
+}
+
+// respondToUserMessage stores a user message on the current branch and runs
+// the session's discussion, workflow or debate on it.
+func respondToUserMessage(sc *SafeConn, orch *services.Orchestrator, sessionID, content string, mentionedModels, attachments []string) {
 	userMsg := database.Message{
-		ID:        userMsgID,
-		SessionID: sessionID,
-		Role:      "user",
-		Content:   content,
-		CreatedAt: now,
+		ID:          uuid.New().String(),
+		SessionID:   sessionID,
+		ParentID:    orch.LastMessageID(),
+		Role:        "user",
+		Content:     content,
+		Attachments: attachments,
+		CreatedAt:   time.Now(),
 	}
+	database.InsertMessage(userMsg)
 	orch.AddToHistory(userMsg)
 
-	sc.WriteJSON(services.StreamMessage{Type: "round_start", Round: 0})
-
 	contentMentions := services.ExtractMentionsFromUserMessage(content, orch.ModelConfigs)
 	allMentions := append(mentionedModels, contentMentions...)
-	respondingModels := orch.GetRespondingModels(allMentions, content)
 	cleanContent := services.StripMentions(content)
 
-	processModelResponses(sc, orch, sessionID, respondingModels, cleanContent, 0)
+	// Mentioning models explicitly bypasses workflows and debates
+	if len(orch.Workflow.Stages) > 0 && len(allMentions) == 0 {
+		runWorkflow(sc, orch, sessionID, cleanContent)
+	} else if orch.Debate.Mode != "" && len(orch.ModelConfigs) >= 2 && len(allMentions) == 0 {
+		runDebate(sc, orch, sessionID, cleanContent)
+	} else {
+		respondingModels, decision := orch.GetRespondingModels(allMentions, content)
+		if decision != nil {
+			database.SetMessageRouting(sessionID, userMsg.ID, *decision)
+			sc.WriteJSON(services.StreamMessage{Type: "routing", Content: decision.Reason, Routing: decision})
+		}
+		runDiscussion(sc, orch, sessionID, respondingModels, cleanContent)
+	}
+
+	tokenUsage := make(map[string]int)
+	for _, m := range orch.ModelConfigs {
+		tokenUsage[m.Name] = 0
+	}
+	for _, msg := range orch.History {
+		if msg.ModelName != nil {
+			tokenUsage[*msg.ModelName] += msg.TokensUsed
+		}
+	}
+	sc.WriteJSON(map[string]interface{}{
+		"type":  "token_usage",
+		"usage": tokenUsage,
+	})
+}
+
+// runDiscussion lets the addressed models answer, then runs the autonomy
+// rounds in the session's turn-taking mode.
+func runDiscussion(sc *SafeConn, orch *services.Orchestrator, sessionID string, respondingModels []database.ModelConfig, prompt string) {
+	sc.WriteJSON(services.StreamMessage{Type: "round_start", Round: 0})
+
+	handoffs := maxMentionHandoffs
+	processModelResponses(sc, orch, sessionID, respondingModels, prompt, 0, &handoffs)
 
 	sc.WriteJSON(services.StreamMessage{Type: "round_end", Round: 0})
 
-	if orch.AutonomyRounds > 0 && len(orch.ModelConfigs) >= 2 && !orch.IsStopped() {
+	if orch.AutonomyRounds > 0 && len(orch.ModelConfigs) >= 2 && !orch.IsStopped() && orch.TurnTaking.Mode == database.TurnTakingModerator {
+		runModeratedDiscussion(sc, orch, sessionID, &handoffs)
+	} else if orch.AutonomyRounds > 0 && len(orch.ModelConfigs) >= 2 && !orch.IsStopped() {
 		for round := 1; round <= orch.AutonomyRounds && !orch.IsStopped(); round++ {
 			sc.WriteJSON(services.StreamMessage{Type: "round_start", Round: round})
 
@@ -174,29 +241,289 @@ func handleUserMessage(sc *SafeConn, orch *services.Orchestrator, sessionID, con
 					time.Sleep(100 * time.Millisecond)
 				}
 
-				generateModelResponseWithReturn(sc, orch, sessionID, model, "", round)
+				respondAndFollowMentions(sc, orch, sessionID, model, "", round, &handoffs)
 			}
 
 			sc.WriteJSON(services.StreamMessage{Type: "round_end", Round: round})
 		}
 	}
+}
 
-	tokenUsage := make(map[string]int)
-	for _, m := range orch.ModelConfigs {
-		tokenUsage[m.Name] = 0
+// runWorkflow answers a user message with the session's workflow, running
+// each stage's model once its dependencies are done and looping back when a
+// reviewing stage does not approve.
+func runWorkflow(sc *SafeConn, orch *services.Orchestrator, sessionID, input string) {
+	run := services.NewWorkflowRun(orch.Workflow, input)
+	sc.WriteJSON(services.StreamMessage{Type: "workflow_start", Content: fmt.Sprintf("%d stages", len(orch.Workflow.Stages))})
+
+	result := "completed"
+	for !orch.IsStopped() {
+		stage, ok := run.Next()
+		if !ok {
+			break
+		}
+		model, ok := services.StageModel(stage, orch.ModelConfigs)
+		if !ok {
+			sc.WriteJSON(services.StreamMessage{
+				Type:  "error",
+				Stage: stage.ID,
+				Error: fmt.Sprintf("No model in this session matches workflow stage %s", stage.ID),
+			})
+			result = "failed"
+			break
+		}
+
+		for orch.IsPaused() && !orch.IsStopped() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		iteration := run.Iteration(stage)
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "stage_start",
+			Stage:     stage.ID,
+			ModelID:   model.ShortID,
+			ModelName: model.Name,
+			Round:     iteration,
+			Color:     model.Color,
+		})
+		output := generateModelResponseWithReturn(sc, orch, sessionID, model, run.Prompt(stage), iteration)
+		if output == "" {
+			if !orch.IsStopped() {
+				result = "failed"
+			}
+			break
+		}
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "stage_complete",
+			Stage:     stage.ID,
+			ModelID:   model.ShortID,
+			ModelName: model.Name,
+			Round:     iteration,
+			Color:     model.Color,
+		})
+
+		loopTo, exhausted := run.Complete(stage, output)
+		if loopTo != "" {
+			sc.WriteJSON(services.StreamMessage{Type: "workflow_loop", Stage: stage.ID, Content: loopTo, Round: iteration})
+		}
+		if exhausted {
+			// Later stages still run on the last attempt
+			result = "max_iterations"
+		}
 	}
-	for _, msg := range orch.History {
-		if msg.ModelName != nil {
-			tokenUsage[*msg.ModelName] += msg.TokensUsed
+	if orch.IsStopped() {
+		result = "stopped"
+	}
+
+	sc.WriteJSON(services.StreamMessage{Type: "workflow_end", Content: result})
+}
+
+// runDebate has every model answer without seeing the others, runs the
+// critique rounds, and ends with a judge's synthesis or a vote. The final
+// answer is stored as a message of kind final.
+func runDebate(sc *SafeConn, orch *services.Orchestrator, sessionID, prompt string) {
+	debate := orch.Debate
+	phase := func(name string, round int) {
+		sc.WriteJSON(services.StreamMessage{Type: "debate_phase", Content: name, Round: round})
+	}
+	each := func(round int, kind string, promptFor func(database.ModelConfig) string) map[string]string {
+		responses := make(map[string]string)
+		if orch.ParallelResponses {
+			for i, response := range generateParallelResponses(sc, orch, sessionID, orch.ModelConfigs, promptFor, round, kind) {
+				responses[orch.ModelConfigs[i].ShortID] = response
+			}
+			return responses
+		}
+		for _, model := range orch.ModelConfigs {
+			if orch.IsStopped() {
+				break
+			}
+			for orch.IsPaused() && !orch.IsStopped() {
+				time.Sleep(100 * time.Millisecond)
+			}
+			responses[model.ShortID] = generateModelResponseOfKind(sc, orch, sessionID, model, promptFor(model), round, kind)
 		}
+		return responses
+	}
+
+	phase("answers", 0)
+	orch.SetBlind(database.MessageKindAnswer)
+	each(0, database.MessageKindAnswer, func(database.ModelConfig) string { return prompt })
+	orch.SetBlind()
+
+	for round := 1; round <= debate.CritiqueRounds && !orch.IsStopped(); round++ {
+		phase("critique", round)
+		critique := services.DebateCritiquePrompt(round, debate.CritiqueRounds)
+		each(round, database.MessageKindCritique, func(database.ModelConfig) string { return critique })
+	}
+	if orch.IsStopped() {
+		return
+	}
+
+	final := debate.CritiqueRounds + 1
+	if debate.Mode == database.DebateModeVote {
+		phase("vote", final)
+		// Voters see every answer but not each other's votes
+		orch.SetBlind(database.MessageKindVote)
+		votes := each(final, database.MessageKindVote, orch.DebateVotePrompt)
+		orch.SetBlind()
+		if orch.IsStopped() {
+			return
+		}
+
+		winner, tally := orch.TallyVotes(votes)
+		modelID := winner.ShortID
+		modelName := winner.Name
+		result := database.Message{
+			ID:          uuid.New().String(),
+			SessionID:   sessionID,
+			ParentID:    orch.LastMessageID(),
+			Role:        winner.ShortID,
+			ModelID:     &modelID,
+			ModelName:   &modelName,
+			Content:     fmt.Sprintf("%s\n\n*Chosen by vote: %s*", orch.LatestDebateAnswer(winner.ShortID), tally),
+			RoundNumber: final,
+			Kind:        database.MessageKindFinal,
+			CreatedAt:   time.Now(),
+		}
+		database.InsertMessage(result)
+		orch.AddToHistory(result)
+
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "debate_result",
+			ModelID:   winner.ShortID,
+			ModelName: winner.Name,
+			Content:   result.Content,
+			Round:     final,
+			Color:     winner.Color,
+			Kind:      database.MessageKindFinal,
+		})
+		return
+	}
+
+	phase("synthesis", final)
+	judge := orch.DebateJudge()
+	content := generateModelResponseOfKind(sc, orch, sessionID, judge, services.DebateJudgePrompt(), final, database.MessageKindFinal)
+	if content != "" {
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "debate_result",
+			ModelID:   judge.ShortID,
+			ModelName: judge.Name,
+			Content:   content,
+			Round:     final,
+			Color:     judge.Color,
+			Kind:      database.MessageKindFinal,
+		})
+	}
+}
+
+// runModeratedDiscussion lets the moderator pick one speaker per round until
+// it ends the discussion or the turns a round-robin discussion would have
+// taken are used up.
+func runModeratedDiscussion(sc *SafeConn, orch *services.Orchestrator, sessionID string, handoffs *int) {
+	maxTurns := orch.AutonomyRounds * len(orch.ModelConfigs)
+	for round := 1; round <= maxTurns && !orch.IsStopped(); round++ {
+		for orch.IsPaused() && !orch.IsStopped() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		decision := orch.NextSpeaker()
+		if orch.IsStopped() {
+			break
+		}
+		if decision.Done {
+			sc.WriteJSON(services.StreamMessage{Type: "discussion_end", Content: decision.Reason, Round: round})
+			return
+		}
+
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "moderator",
+			ModelID:   decision.Next.ShortID,
+			ModelName: decision.Next.Name,
+			Content:   decision.Reason,
+			Round:     round,
+			Color:     decision.Next.Color,
+		})
+		sc.WriteJSON(services.StreamMessage{Type: "round_start", Round: round})
+		respondAndFollowMentions(sc, orch, sessionID, *decision.Next, "", round, handoffs)
+		sc.WriteJSON(services.StreamMessage{Type: "round_end", Round: round})
 	}
-	sc.WriteJSON(map[string]interface{}{
-		"type":  "token_usage",
-		"usage": tokenUsage,
-	})
 }
 
-func processModelResponses(sc *SafeConn, orch *services.Orchestrator, sessionID string, models []database.ModelConfig, prompt string, round int) {
+// handleEditMessage replaces a user message with an edited copy on a new
+// branch and lets the models answer it again. The original stays reachable.
+func handleEditMessage(sc *SafeConn, orch *services.Orchestrator, sessionID, messageID, content string, mentionedModels, attachments []string) {
+	original, err := database.GetMessage(sessionID, messageID)
+	if err != nil || original.Role != "user" {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Only your own messages can be edited"})
+		return
+	}
+	if strings.TrimSpace(content) == "" {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Edited message cannot be empty"})
+		return
+	}
+	if err := checkSessionAttachments(sessionID, attachments); err != nil {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	end := orch.Interrupt()
+	defer end()
+	if _, ok := orch.RewindTo(messageID); !ok {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Message is not on the current branch"})
+		return
+	}
+	if attachments == nil {
+		attachments = original.Attachments
+	}
+
+	sc.WriteJSON(services.StreamMessage{Type: "rewind", Content: messageID})
+	respondToUserMessage(sc, orch, sessionID, content, mentionedModels, attachments)
+}
+
+// handleRegenerate asks the same model to answer again, keeping the previous
+// answer as a sibling branch.
+func handleRegenerate(sc *SafeConn, orch *services.Orchestrator, sessionID, messageID string) {
+	original, err := database.GetMessage(sessionID, messageID)
+	if err != nil || original.ModelID == nil {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Only model responses can be regenerated"})
+		return
+	}
+
+	var model *database.ModelConfig
+	for i := range orch.ModelConfigs {
+		if orch.ModelConfigs[i].ShortID == *original.ModelID {
+			model = &orch.ModelConfigs[i]
+			break
+		}
+	}
+	if model == nil {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "That model is no longer part of this session"})
+		return
+	}
+
+	end := orch.Interrupt()
+	defer end()
+	if _, ok := orch.RewindTo(messageID); !ok {
+		sc.WriteJSON(services.StreamMessage{Type: "error", Error: "Message is not on the current branch"})
+		return
+	}
+
+	sc.WriteJSON(services.StreamMessage{Type: "rewind", Content: messageID})
+	sc.WriteJSON(services.StreamMessage{Type: "round_start", Round: original.RoundNumber})
+	generateModelResponseWithReturn(sc, orch, sessionID, *model, "", original.RoundNumber)
+	sc.WriteJSON(services.StreamMessage{Type: "round_end", Round: original.RoundNumber})
+}
+
+func processModelResponses(sc *SafeConn, orch *services.Orchestrator, sessionID string, models []database.ModelConfig, prompt string, round int, handoffs *int) {
+	if orch.ParallelResponses && len(models) > 1 {
+		responses := generateParallelResponses(sc, orch, sessionID, models, func(database.ModelConfig) string { return prompt }, round, "")
+		for i, model := range models {
+			followMentions(sc, orch, sessionID, model, responses[i], round, handoffs)
+		}
+		return
+	}
+
 	for _, model := range models {
 		if orch.IsStopped() {
 			break
@@ -206,11 +533,129 @@ func processModelResponses(sc *SafeConn, orch *services.Orchestrator, sessionID
 			time.Sleep(100 * time.Millisecond)
 		}
 
-		generateModelResponseWithReturn(sc, orch, sessionID, model, prompt, round)
+		respondAndFollowMentions(sc, orch, sessionID, model, prompt, round, handoffs)
+	}
+}
+
+// generateParallelResponses streams several models' responses at once.
+// Every model sees the history as it was before any of them answered, and
+// the responses join the history in the order of models once all are done,
+// so the result does not depend on which model finishes first.
+func generateParallelResponses(sc *SafeConn, orch *services.Orchestrator, sessionID string, models []database.ModelConfig, promptFor func(database.ModelConfig) string, round int, kind string) []string {
+	for orch.IsPaused() && !orch.IsStopped() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	responses := make([]string, len(models))
+	if orch.IsStopped() {
+		return responses
+	}
+
+	prepared := make([][]services.ChatMessage, len(models))
+	for i, model := range models {
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "thinking",
+			ModelID:   model.ShortID,
+			ModelName: model.Name,
+			Color:     model.Color,
+			Kind:      kind,
+		})
+		prepared[i] = orch.BuildChatMessages(model, promptFor(model))
+	}
+
+	type result struct {
+		content string
+		tokens  int
+		ok      bool
+	}
+	results := make([]result, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		wg.Add(1)
+		go func(i int, model database.ModelConfig) {
+			defer wg.Done()
+			content, tokens, ok := streamModelResponse(sc, orch, model, prepared[i], kind)
+			results[i] = result{content: content, tokens: tokens, ok: ok}
+		}(i, model)
+	}
+	wg.Wait()
+
+	for i, model := range models {
+		if results[i].ok {
+			responses[i] = saveModelResponse(sc, orch, sessionID, model, results[i].content, results[i].tokens, round, kind)
+		}
+	}
+	return responses
+}
+
+// respondAndFollowMentions generates a model's response and then lets the
+// models it @mentioned answer next.
+func respondAndFollowMentions(sc *SafeConn, orch *services.Orchestrator, sessionID string, model database.ModelConfig, prompt string, round int, handoffs *int) {
+	response := generateModelResponseWithReturn(sc, orch, sessionID, model, prompt, round)
+	followMentions(sc, orch, sessionID, model, response, round, handoffs)
+}
+
+// followMentions lets the models a response @mentioned answer next,
+// following their mentions in turn until the chain reaches maxMentionDepth
+// or the hand-off budget runs out.
+func followMentions(sc *SafeConn, orch *services.Orchestrator, sessionID string, speaker database.ModelConfig, response string, round int, handoffs *int) {
+	type turn struct {
+		model database.ModelConfig
+		depth int
+	}
+	var queue []turn
+	enqueue := func(from database.ModelConfig, response string, depth int) {
+		if response == "" || depth > maxMentionDepth {
+			return
+		}
+		for _, mentioned := range orch.MentionedModels(response, from.ShortID) {
+			queued := false
+			for _, t := range queue {
+				if t.model.ShortID == mentioned.ShortID {
+					queued = true
+					break
+				}
+			}
+			if queued {
+				continue
+			}
+			if *handoffs <= 0 {
+				return
+			}
+			*handoffs--
+
+			sc.WriteJSON(services.StreamMessage{
+				Type:      "mention",
+				ModelID:   mentioned.ShortID,
+				ModelName: mentioned.Name,
+				Content:   from.ShortID,
+				Round:     round,
+				Color:     mentioned.Color,
+			})
+			queue = append(queue, turn{model: mentioned, depth: depth})
+		}
+	}
+
+	enqueue(speaker, response, 1)
+	for len(queue) > 0 && !orch.IsStopped() {
+		current := queue[0]
+		queue = queue[1:]
+
+		for orch.IsPaused() && !orch.IsStopped() {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		response := generateModelResponseWithReturn(sc, orch, sessionID, current.model, "", round)
+		enqueue(current.model, response, current.depth+1)
 	}
 }
 
 func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator, sessionID string, model database.ModelConfig, prompt string, round int) string {
+	return generateModelResponseOfKind(sc, orch, sessionID, model, prompt, round, "")
+}
+
+// generateModelResponseOfKind streams and stores a response whose message
+// is marked with the given kind, such as a debate critique.
+func generateModelResponseOfKind(sc *SafeConn, orch *services.Orchestrator, sessionID string, model database.ModelConfig, prompt string, round int, kind string) string {
 	if orch.IsStopped() {
 		return ""
 	}
@@ -220,10 +665,21 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 		ModelID:   model.ShortID,
 		ModelName: model.Name,
 		Color:     model.Color,
+		Kind:      kind,
 	})
 
 	messages := orch.BuildChatMessages(model, prompt)
+	content, tokens, ok := streamModelResponse(sc, orch, model, messages, kind)
+	if !ok {
+		return ""
+	}
+	return saveModelResponse(sc, orch, sessionID, model, content, tokens, round, kind)
+}
 
+// streamModelResponse runs a model on prepared messages, streaming chunks,
+// tool calls and retries to the client while holding one of its provider's
+// slots. ok is false when nothing could be generated.
+func streamModelResponse(sc *SafeConn, orch *services.Orchestrator, model database.ModelConfig, messages []services.ChatMessage, kind string) (string, int, bool) {
 	var fullResponse string
 	var totalTokens int
 	startTime := time.Now()
@@ -259,6 +715,7 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 			Tokens:          totalTokens,
 			TokensPerSecond: tokensPerSecond,
 			Color:           model.Color,
+			Kind:            kind,
 		})
 
 		chunkBuffer = ""
@@ -277,7 +734,7 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 		}
 	}()
 
-	err := services.StreamChatToProvider(orch.Context(), model.ModelID, messages, func(chunk string, done bool, tokens int) {
+	onChunk := func(chunk string, done bool, tokens int) {
 		if orch.IsStopped() {
 			return
 		}
@@ -295,7 +752,112 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 		if done {
 			flushBuffer(true)
 		}
-	})
+	}
+
+	opts := services.ChatOptions{
+		Params: model.Params,
+		Tools:  services.Tools.Definitions(model.Tools),
+	}
+
+	policy := services.RetryPolicyFor(model.Retry)
+	onRetry := func(attempt int, wait time.Duration, err error) {
+		log.Printf("Retrying %s in %s (attempt %d): %v", model.ModelID, wait, attempt, err)
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "retry",
+			ModelID:   model.ShortID,
+			ModelName: model.Name,
+			Content:   fmt.Sprintf("Retrying in %.0fs...", wait.Seconds()),
+			Error:     err.Error(),
+			Color:     model.Color,
+		})
+	}
+
+	// The configured model is tried first, then each fallback in order
+	candidates := append([]string{model.ModelID}, model.FallbackModels...)
+	onFallback := func(from, to string, err error) {
+		log.Printf("Falling back from %s to %s: %v", from, to, err)
+		sc.WriteJSON(services.StreamMessage{
+			Type:      "fallback",
+			ModelID:   model.ShortID,
+			ModelName: model.Name,
+			Content:   to,
+			Error:     parseAPIError(err, from),
+			Color:     model.Color,
+		})
+	}
+
+	var err error
+	var lastModel string
+	start := 0
+	for step := 0; ; step++ {
+		bufferMu.Lock()
+		stepStart := len(fullResponse)
+		bufferMu.Unlock()
+
+		var toolCalls []services.ToolCall
+		// Stay on the working model for the remaining tool steps
+		toolCalls, start, err = streamWithFallback(orch.Context(), candidates, start, messages, opts, policy, onChunk, onRetry, onFallback, orch.IsStopped)
+		lastModel = candidates[start]
+		if err != nil || len(toolCalls) == 0 || orch.IsStopped() {
+			break
+		}
+		if step >= maxToolSteps {
+			log.Printf("Tool call limit reached for %s", model.ModelID)
+			break
+		}
+
+		bufferMu.Lock()
+		stepText := fullResponse[stepStart:]
+		bufferMu.Unlock()
+
+		messages = append(messages, services.ChatMessage{
+			Role:      "assistant",
+			Content:   stepText,
+			ToolCalls: toolCalls,
+		})
+
+		for _, call := range toolCalls {
+			sc.WriteJSON(services.StreamMessage{
+				Type:       "tool_call",
+				ModelID:    model.ShortID,
+				ModelName:  model.Name,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+				ToolArgs:   string(call.Arguments),
+				Color:      model.Color,
+			})
+
+			result, ok := services.Tools.Execute(orch.Context(), call)
+
+			resultMsg := services.StreamMessage{
+				Type:       "tool_result",
+				ModelID:    model.ShortID,
+				ModelName:  model.Name,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+				Content:    result,
+				Color:      model.Color,
+			}
+			if !ok {
+				resultMsg.Error = result
+			}
+			sc.WriteJSON(resultMsg)
+
+			messages = append(messages, services.ChatMessage{
+				Role:       "tool",
+				Content:    result,
+				ToolCallID: call.ID,
+				ToolName:   call.Name,
+			})
+		}
+
+		bufferMu.Lock()
+		if stepText != "" {
+			fullResponse += "\n\n"
+			chunkBuffer += "\n\n"
+		}
+		bufferMu.Unlock()
+	}
 
 	// If stopped or error but we have partial content, still save it
 	wasStopped := orch.IsStopped()
@@ -303,40 +865,72 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 		// Log raw error for debugging
 		log.Printf("API error for %s: %s", model.ModelID, err.Error())
 		// Parse the error and provide helpful guidance
-		errorMsg := parseAPIError(err.Error(), model.ModelID)
+		errorMsg := parseAPIError(err, lastModel)
 		sc.WriteJSON(services.StreamMessage{
 			Type:      "error",
 			ModelID:   model.ShortID,
 			ModelName: model.Name,
 			Error:     errorMsg,
 		})
-		return ""
+		return "", 0, false
 	}
 
 	if wasStopped && fullResponse != "" {
 		fullResponse += "\n\n*[Response stopped by user]*"
 	}
 
-	msgID := uuid.New().String()
-	now := time.Now()
-	database.DB.Exec(`
-		INSERT INTO messages (id, session_id, role, model_id, model_name, content, round_number, tokens_used, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`, msgID, sessionID, model.ShortID, model.ShortID, model.Name, fullResponse, round, totalTokens, now)
+	return fullResponse, totalTokens, true
+}
+
+// streamWithFallback streams from candidates[start:] in order, moving to the
+// next candidate only while the current one failed without streaming any
+// output. Each attempt holds a slot on the candidate's own provider. It
+// returns the index of the candidate that produced the result.
+func streamWithFallback(ctx context.Context, candidates []string, start int, messages []services.ChatMessage, opts services.ChatOptions, policy services.RetryPolicy, onChunk func(string, bool, int), onRetry func(int, time.Duration, error), onFallback func(from, to string, err error), stopped func() bool) ([]services.ToolCall, int, error) {
+	streamed := false
+	trackChunk := func(chunk string, done bool, tokens int) {
+		if chunk != "" {
+			streamed = true
+		}
+		onChunk(chunk, done, tokens)
+	}
+
+	for i := start; ; i++ {
+		release, err := services.AcquireProviderSlot(ctx, candidates[i])
+		if err != nil {
+			return nil, i, err
+		}
+		toolCalls, err := services.StreamChatWithRetry(ctx, candidates[i], messages, opts, policy, trackChunk, onRetry)
+		release()
+		if err == nil || stopped() || streamed || i == len(candidates)-1 {
+			return toolCalls, i, err
+		}
+		if onFallback != nil {
+			onFallback(candidates[i], candidates[i+1], err)
+		}
+	}
+}
 
+// saveModelResponse stores a finished response as the newest message on
+// the branch and tells the client it is complete.
+func saveModelResponse(sc *SafeConn, orch *services.Orchestrator, sessionID string, model database.ModelConfig, fullResponse string, totalTokens, round int, kind string) string {
 	modelID := model.ShortID
 	modelName := model.Name
-	orch.AddToHistory(database.Message{
-		ID:          msgID,
+	responseMsg := database.Message{
+		ID:          uuid.New().String(),
 		SessionID:   sessionID,
+		ParentID:    orch.LastMessageID(),
 		Role:        model.ShortID,
 		ModelID:     &modelID,
 		ModelName:   &modelName,
 		Content:     fullResponse,
 		RoundNumber: round,
 		TokensUsed:  totalTokens,
-		CreatedAt:   now,
-	})
+		Kind:        kind,
+		CreatedAt:   time.Now(),
+	}
+	database.InsertMessage(responseMsg)
+	orch.AddToHistory(responseMsg)
 
 	sc.WriteJSON(services.StreamMessage{
 		Type:      "complete",
@@ -345,12 +939,13 @@ func generateModelResponseWithReturn(sc *SafeConn, orch *services.Orchestrator,
 		Content:   fullResponse,
 		Tokens:    totalTokens,
 		Color:     model.Color,
+		Kind:      kind,
 	})
 
 	return fullResponse
 }
 
-func parseAPIError(errMsg string, modelID string) string {
+func parseAPIError(err error, modelID string) string {
 	provider := "the provider"
 	if strings.HasPrefix(modelID, "anthropic:") {
 		provider = "Anthropic"
@@ -368,40 +963,37 @@ func parseAPIError(errMsg string, modelID string) string {
 		provider = "OpenRouter"
 	}
 
-	errLower := strings.ToLower(errMsg)
+	if errors.Is(err, context.Canceled) {
+		return "Stopped by user."
+	}
+
+	pe, ok := services.AsProviderError(err)
+	if !ok {
+		return fmt.Sprintf("%s error: %s", provider, err.Error())
+	}
 
-	if strings.Contains(errLower, "quota") || strings.Contains(errLower, "429") {
-		if strings.Contains(errLower, "limit: 0") || strings.Contains(errLower, "limit\":0") {
+	switch pe.Kind {
+	case services.ErrQuota:
+		msgLower := strings.ToLower(pe.Message)
+		if strings.Contains(msgLower, "limit: 0") || strings.Contains(msgLower, "limit\":0") {
 			return fmt.Sprintf("🚫 This model has no free tier access on %s. Try a different model (e.g., gemini-2.0-flash) or enable billing.", provider)
 		}
+		if strings.Contains(msgLower, "credit") {
+			return fmt.Sprintf("💳 %s requires credits. Please add credits at the provider's billing page.", provider)
+		}
 		return fmt.Sprintf("⏱️ Quota exceeded for %s. You've hit usage limits - wait a bit or check your plan.", provider)
-	}
-	if strings.Contains(errLower, "rate") && strings.Contains(errLower, "limit") {
+	case services.ErrRateLimit:
 		return fmt.Sprintf("⏱️ Rate limit reached for %s. Please wait a moment before trying again.", provider)
-	}
-
-	if strings.Contains(errLower, "credit") && (strings.Contains(errLower, "balance") || strings.Contains(errLower, "low")) {
-		return fmt.Sprintf("💳 %s requires credits. Please add credits at the provider's billing page.", provider)
-	}
-
-	if strings.Contains(errLower, "invalid") && (strings.Contains(errLower, "key") || strings.Contains(errLower, "api")) {
-		return fmt.Sprintf("🔑 Invalid API key for %s. Please check your API key in Settings and make sure it's correct.", provider)
-	}
-	if strings.Contains(errLower, "unauthorized") || strings.Contains(errLower, "authentication") || strings.Contains(errLower, "401") {
+	case services.ErrAuth:
 		return fmt.Sprintf("🔑 Authentication failed for %s. Please verify your API key in Settings.", provider)
-	}
-
-	if strings.Contains(errLower, "not found") || strings.Contains(errLower, "404") || strings.Contains(errLower, "does not exist") {
+	case services.ErrNotFound:
 		return fmt.Sprintf("❌ Model not found. The model '%s' may have been deprecated or renamed. Try selecting a different model.", modelID)
+	case services.ErrTransient:
+		if pe.StatusCode == 0 {
+			return fmt.Sprintf("🌐 Connection error with %s. Please check your internet connection and try again.", provider)
+		}
+		return fmt.Sprintf("🌐 %s is temporarily unavailable. Please try again shortly.", provider)
 	}
 
-	if strings.Contains(errLower, "connection") || strings.Contains(errLower, "timeout") || strings.Contains(errLower, "network") {
-		return fmt.Sprintf("🌐 Connection error with %s. Please check your internet connection and try again.", provider)
-	}
-
-	if strings.Contains(errLower, "context canceled") {
-		return "Stopped by user."
-	}
-
-	return fmt.Sprintf("%s error: %s", provider, errMsg)
+	return fmt.Sprintf("%s error: %s", provider, err.Error())
 }
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"localai/services"
+)
+
+// stubProvider fails for every model listed in failing and streams a fixed
+// reply for any other model it supports.
+type stubProvider struct {
+	failing map[string]bool
+	called  []string
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) StreamChat(ctx context.Context, model string, messages []services.ChatMessage, opts services.ChatOptions, onChunk func(string, bool, int)) ([]services.ToolCall, error) {
+	p.called = append(p.called, model)
+	if p.failing[model] {
+		return nil, errors.New(model + " unavailable")
+	}
+	onChunk("hello from "+model, true, 3)
+	return nil, nil
+}
+
+func (p *stubProvider) ListModels() ([]services.Model, error) { return nil, nil }
+
+func (p *stubProvider) SupportsModel(modelID string) bool { return strings.HasPrefix(modelID, "stub/") }
+
+func TestStreamWithFallback(t *testing.T) {
+	stub := &stubProvider{failing: map[string]bool{
+		"stub/primary": true,
+		"stub/a":       true,
+		"stub/b":       true,
+		"stub/c":       true,
+	}}
+	services.Providers.Register(stub)
+	defer services.Providers.Unregister(stub.Name())
+
+	candidates := []string{"stub/primary", "stub/a", "stub/b", "stub/c", "stub/ok"}
+	var fallbacks []string
+	var output string
+	onChunk := func(chunk string, done bool, tokens int) { output += chunk }
+	onFallback := func(from, to string, err error) { fallbacks = append(fallbacks, from+"->"+to) }
+	policy := services.RetryPolicy{MaxAttempts: 1}
+
+	_, used, err := streamWithFallback(context.Background(), candidates, 0, nil, services.ChatOptions{}, policy, onChunk, nil, onFallback, func() bool { return false })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used != 4 {
+		t.Errorf("used candidate %d, want 4", used)
+	}
+	if output != "hello from stub/ok" {
+		t.Errorf("output = %q", output)
+	}
+	wantFallbacks := "stub/primary->stub/a,stub/a->stub/b,stub/b->stub/c,stub/c->stub/ok"
+	if got := strings.Join(fallbacks, ","); got != wantFallbacks {
+		t.Errorf("fallbacks = %s, want %s", got, wantFallbacks)
+	}
+
+	// A later tool step starts from the working model
+	stub.called = nil
+	if _, used, err = streamWithFallback(context.Background(), candidates, used, nil, services.ChatOptions{}, policy, onChunk, nil, onFallback, func() bool { return false }); err != nil || used != 4 {
+		t.Errorf("second step used %d, err %v", used, err)
+	}
+	if len(stub.called) != 1 || stub.called[0] != "stub/ok" {
+		t.Errorf("second step called %v", stub.called)
+	}
+}
+
+func TestStreamWithFallbackAllFail(t *testing.T) {
+	stub := &stubProvider{failing: map[string]bool{
+		"stub/primary": true,
+		"stub/a":       true,
+		"stub/b":       true,
+		"stub/c":       true,
+	}}
+	services.Providers.Register(stub)
+	defer services.Providers.Unregister(stub.Name())
+
+	candidates := []string{"stub/primary", "stub/a", "stub/b", "stub/c"}
+	_, used, err := streamWithFallback(context.Background(), candidates, 0, nil, services.ChatOptions{}, services.RetryPolicy{MaxAttempts: 1}, func(string, bool, int) {}, nil, nil, func() bool { return false })
+	if err == nil || err.Error() != "stub/c unavailable" {
+		t.Errorf("err = %v, want the last model's error", err)
+	}
+	if used != 3 {
+		t.Errorf("used candidate %d, want 3", used)
+	}
+	if len(stub.called) != 4 {
+		t.Errorf("called %v, want every candidate once", stub.called)
+	}
+}
+
+// namedStub is a stubProvider serving the models under its own name.
+type namedStub struct {
+	*stubProvider
+	name string
+}
+
+func (p namedStub) Name() string { return p.name }
+
+func (p namedStub) SupportsModel(modelID string) bool { return strings.HasPrefix(modelID, p.name+"/") }
+
+func TestStreamWithFallbackWaitsForFallbackProviderSlot(t *testing.T) {
+	primary := &stubProvider{failing: map[string]bool{"stub/primary": true}}
+	backup := namedStub{&stubProvider{}, "backup"}
+	services.Providers.Register(primary)
+	services.Providers.Register(backup)
+	defer services.Providers.Unregister(primary.Name())
+	defer services.Providers.Unregister(backup.Name())
+
+	services.ProviderConcurrency["backup"] = 1
+	defer delete(services.ProviderConcurrency, "backup")
+	release, err := services.AcquireProviderSlot(context.Background(), "backup/model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	candidates := []string{"stub/primary", "backup/model"}
+	_, used, err := streamWithFallback(ctx, candidates, 0, nil, services.ChatOptions{}, services.RetryPolicy{MaxAttempts: 1}, func(string, bool, int) {}, nil, nil, func() bool { return false })
+	if err == nil || used != 1 {
+		t.Errorf("used %d, err %v; want to wait for the busy fallback provider", used, err)
+	}
+	if len(backup.called) != 0 {
+		t.Errorf("fallback provider called %v while its only slot was taken", backup.called)
+	}
+}
@@ -20,15 +20,19 @@ func main() {
 
 	services.InitOllama("http://localhost:11434")
 	initCloudProviders()
+	initRoles()
+	services.RegisterBuiltinTools()
+	services.RegisterBuiltinDocumentParsers()
 
 	app := fiber.New(fiber.Config{
-		AppName: "LocalAI",
+		AppName:   "LocalAI",
+		BodyLimit: 50 * 1024 * 1024,
 	})
 
 	app.Use(logger.New())
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
 	}))
 
 	app.Get("/api/health", handlers.HealthCheck)
@@ -41,20 +45,65 @@ func main() {
 	app.Post("/api/models/import", handlers.ImportGGUF)
 	app.Get("/api/models/gguf", handlers.ListGGUFFiles)
 
-	app.Post("/api/documents/parse", handlers.ParseDocument)
+	app.Get("/api/tools", handlers.ListTools)
+
+	app.Post("/api/embeddings", handlers.CreateEmbeddings)
+
+	app.Post("/api/documents", handlers.UploadDocument)
+
+	app.Post("/api/attachments", handlers.UploadAttachment)
+	app.Get("/api/attachments/:id", handlers.GetAttachment)
+	app.Delete("/api/attachments/:id", handlers.DeleteAttachment)
+
+	app.Get("/api/search", handlers.Search)
 
 	app.Get("/api/sessions", handlers.ListSessions)
 	app.Post("/api/sessions", handlers.CreateSession)
+	app.Post("/api/sessions/import", handlers.ImportSession)
 	app.Get("/api/sessions/:id", handlers.GetSession)
 	app.Put("/api/sessions/:id", handlers.UpdateSession)
 	app.Delete("/api/sessions/:id", handlers.DeleteSession)
+	app.Post("/api/sessions/:id/fork", handlers.ForkSession)
+	app.Post("/api/sessions/:id/clone", handlers.CloneSession)
+	app.Post("/api/sessions/:id/template", handlers.SaveSessionAsTemplate)
+	app.Get("/api/sessions/:id/export", handlers.ExportSession)
+	app.Get("/api/sessions/:id/documents", handlers.ListSessionDocuments)
+	app.Post("/api/sessions/:id/documents", handlers.IndexSessionDocument)
+	app.Delete("/api/sessions/:id/documents/:docId", handlers.DeleteSessionDocument)
+	app.Put("/api/sessions/:id/branch", handlers.SwitchBranch)
+	app.Put("/api/sessions/:id/messages/:messageId/pin", handlers.PinMessage)
 
 	app.Get("/api/providers", handlers.ListProviders)
+	app.Get("/api/providers/custom", handlers.ListCustomProviders)
+	app.Post("/api/providers/custom", handlers.CreateCustomProvider)
+	app.Put("/api/providers/custom/:name", handlers.UpdateCustomProvider)
+	app.Delete("/api/providers/custom/:name", handlers.DeleteCustomProvider)
 	app.Put("/api/providers/:name/key", handlers.SetProviderKey)
 	app.Delete("/api/providers/:name/key", handlers.DeleteProviderKey)
 	app.Put("/api/providers/:name/toggle", handlers.ToggleProvider)
 	app.Get("/api/providers/:name/models", handlers.GetProviderModels)
 
+	app.Get("/api/templates", handlers.ListTemplates)
+	app.Post("/api/templates", handlers.CreateTemplate)
+	app.Get("/api/templates/:id", handlers.GetTemplate)
+	app.Delete("/api/templates/:id", handlers.DeleteTemplate)
+	app.Post("/api/templates/:id/sessions", handlers.CreateSessionFromTemplate)
+
+	app.Get("/api/personas", handlers.ListPersonas)
+	app.Post("/api/personas", handlers.CreatePersona)
+	app.Get("/api/personas/:id", handlers.GetPersona)
+	app.Put("/api/personas/:id", handlers.UpdatePersona)
+	app.Delete("/api/personas/:id", handlers.DeletePersona)
+
+	app.Get("/api/roles", handlers.ListRoles)
+	app.Post("/api/roles", handlers.CreateRole)
+	app.Put("/api/roles/:name", handlers.UpdateRole)
+	app.Delete("/api/roles/:name", handlers.DeleteRole)
+
+	app.Get("/v1/models", handlers.ListOpenAIModels)
+	app.Post("/v1/chat/completions", handlers.ChatCompletions)
+	app.Post("/v1/embeddings", handlers.OpenAIEmbeddings)
+
 	app.Use("/ws", func(c *fiber.Ctx) error {
 		if websocket.IsWebSocketUpgrade(c) {
 			return c.Next()
@@ -69,7 +118,28 @@ func main() {
 	}
 }
 
+func initRoles() {
+	roles, err := database.GetAllRoles()
+	if err != nil {
+		log.Printf("Failed to load custom roles: %v", err)
+		return
+	}
+	for _, r := range roles {
+		services.SetCustomRole(r)
+	}
+}
+
 func initCloudProviders() {
+	customProviders, err := database.GetAllCustomProviders()
+	if err == nil {
+		for _, cp := range customProviders {
+			services.SetCustomProviderConfig(cp)
+			if cp.Enabled {
+				services.RegisterOpenAIProvider(cp.Name, cp.APIKey)
+			}
+		}
+	}
+
 	keys, err := database.GetAllProviderKeys()
 	if err != nil {
 		return
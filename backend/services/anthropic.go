@@ -101,28 +101,59 @@ func (p *AnthropicProvider) ListModels() ([]Model, error) {
 }
 
 type anthropicRequest struct {
-	Model     string             `json:"model"`
-	MaxTokens int                `json:"max_tokens"`
-	System    string             `json:"system,omitempty"`
-	Messages  []anthropicMessage `json:"messages"`
-	Stream    bool               `json:"stream"`
+	Model         string             `json:"model"`
+	MaxTokens     int                `json:"max_tokens"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	Stream        bool               `json:"stream"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	TopK          int                `json:"top_k,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+	Tools         []anthropicTool    `json:"tools,omitempty"`
 }
 
 type anthropicMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+type anthropicContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	Source    *anthropicImage `json:"source,omitempty"`
+}
+
+type anthropicImage struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
 }
 
 type anthropicStreamEvent struct {
 	Type  string `json:"type"`
 	Index int    `json:"index,omitempty"`
 	Delta *struct {
-		Type string `json:"type"`
-		Text string `json:"text"`
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
 	} `json:"delta,omitempty"`
 	ContentBlock *struct {
 		Type string `json:"type"`
 		Text string `json:"text"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
 	} `json:"content_block,omitempty"`
 	Message *struct {
 		Usage struct {
@@ -133,43 +164,111 @@ type anthropicStreamEvent struct {
 	Usage *struct {
 		OutputTokens int `json:"output_tokens"`
 	} `json:"usage,omitempty"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
 }
 
-func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string, bool, int)) error {
-	if strings.HasPrefix(model, "anthropic:") {
-		model = strings.TrimPrefix(model, "anthropic:")
-	}
-
+// toAnthropicMessages converts chat messages to Anthropic's content-block
+// format. Tool results must be sent as tool_result blocks in a user turn, so
+// consecutive tool messages are folded into a single user message.
+func toAnthropicMessages(messages []ChatMessage) (string, []anthropicMessage) {
 	var systemPrompt string
-	var anthropicMessages []anthropicMessage
+	var result []anthropicMessage
 
 	for _, m := range messages {
-		if m.Role == "system" {
+		switch {
+		case m.Role == "system":
 			systemPrompt = m.Content
-		} else {
-			anthropicMessages = append(anthropicMessages, anthropicMessage{
-				Role:    m.Role,
-				Content: m.Content,
-			})
+
+		case m.Role == "tool":
+			block := anthropicContentBlock{
+				Type:      "tool_result",
+				ToolUseID: m.ToolCallID,
+				Content:   m.Content,
+			}
+			if n := len(result); n > 0 && result[n-1].Role == "user" && result[n-1].Content[len(result[n-1].Content)-1].Type == "tool_result" {
+				result[n-1].Content = append(result[n-1].Content, block)
+			} else {
+				result = append(result, anthropicMessage{Role: "user", Content: []anthropicContentBlock{block}})
+			}
+
+		default:
+			var blocks []anthropicContentBlock
+			for _, part := range m.ContentParts() {
+				switch {
+				case part.Type == "text" && part.Text != "":
+					blocks = append(blocks, anthropicContentBlock{Type: "text", Text: part.Text})
+				case part.Type == "image":
+					blocks = append(blocks, anthropicContentBlock{
+						Type:   "image",
+						Source: &anthropicImage{Type: "base64", MediaType: part.MimeType, Data: part.Data},
+					})
+				}
+			}
+			for _, tc := range m.ToolCalls {
+				input := tc.Arguments
+				if len(input) == 0 {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicContentBlock{
+					Type:  "tool_use",
+					ID:    tc.ID,
+					Name:  tc.Name,
+					Input: input,
+				})
+			}
+			if len(blocks) == 0 {
+				continue
+			}
+			result = append(result, anthropicMessage{Role: m.Role, Content: blocks})
 		}
 	}
 
+	return systemPrompt, result
+}
+
+func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error) {
+	if strings.HasPrefix(model, "anthropic:") {
+		model = strings.TrimPrefix(model, "anthropic:")
+	}
+	params := opts.Params
+
+	systemPrompt, anthropicMessages := toAnthropicMessages(messages)
+
+	maxTokens := 4096
+	if params.MaxTokens > 0 {
+		maxTokens = params.MaxTokens
+	}
+
 	reqBody := anthropicRequest{
-		Model:     model,
-		MaxTokens: 4096,
-		System:    systemPrompt,
-		Messages:  anthropicMessages,
-		Stream:    true,
+		Model:         model,
+		MaxTokens:     maxTokens,
+		System:        systemPrompt,
+		Messages:      anthropicMessages,
+		Stream:        true,
+		Temperature:   params.Temperature,
+		TopP:          params.TopP,
+		TopK:          params.TopK,
+		StopSequences: params.Stop,
+	}
+	for _, t := range opts.Tools {
+		reqBody.Tools = append(reqBody.Tools, anthropicTool{
+			Name:        t.Name,
+			Description: t.Description,
+			InputSchema: t.Parameters,
+		})
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -180,24 +279,27 @@ func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messag
 	resp, err := client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ctx.Err()
+			return nil, ctx.Err()
 		}
-		return fmt.Errorf("failed to connect to Anthropic: %w", err)
+		return nil, newConnectionError("Anthropic", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Anthropic API error (%d): %s", resp.StatusCode, string(body))
+		return nil, newHTTPError("Anthropic", resp)
 	}
 
 	reader := bufio.NewReader(resp.Body)
 	totalTokens := 0
 
+	var toolCalls []ToolCall
+	var toolInputs []string
+	toolBlocks := make(map[int]int)
+
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
@@ -207,9 +309,9 @@ func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messag
 				break
 			}
 			if ctx.Err() != nil {
-				return ctx.Err()
+				return nil, ctx.Err()
 			}
-			return err
+			return nil, err
 		}
 
 		lineStr := strings.TrimSpace(string(line))
@@ -229,8 +331,21 @@ func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messag
 		}
 
 		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock != nil && event.ContentBlock.Type == "tool_use" {
+				toolBlocks[event.Index] = len(toolCalls)
+				toolCalls = append(toolCalls, ToolCall{ID: event.ContentBlock.ID, Name: event.ContentBlock.Name})
+				toolInputs = append(toolInputs, "")
+			}
 		case "content_block_delta":
-			if event.Delta != nil && event.Delta.Text != "" {
+			if event.Delta == nil {
+				continue
+			}
+			if event.Delta.Type == "input_json_delta" {
+				if i, ok := toolBlocks[event.Index]; ok {
+					toolInputs[i] += event.Delta.PartialJSON
+				}
+			} else if event.Delta.Text != "" {
 				onChunk(event.Delta.Text, false, totalTokens)
 			}
 		case "message_delta":
@@ -239,9 +354,30 @@ func (p *AnthropicProvider) StreamChat(ctx context.Context, model string, messag
 			}
 		case "message_stop":
 			onChunk("", true, totalTokens)
-			return nil
+			return finishAnthropicToolCalls(toolCalls, toolInputs), nil
+		case "error":
+			kind := ErrUnknown
+			message := "stream error"
+			if event.Error != nil {
+				message = event.Error.Message
+				if event.Error.Type == "overloaded_error" || event.Error.Type == "api_error" {
+					kind = ErrTransient
+				}
+			}
+			return nil, &ProviderError{Provider: "Anthropic", Kind: kind, Message: message}
 		}
 	}
 
-	return nil
+	return finishAnthropicToolCalls(toolCalls, toolInputs), nil
+}
+
+func finishAnthropicToolCalls(toolCalls []ToolCall, inputs []string) []ToolCall {
+	for i := range toolCalls {
+		if inputs[i] == "" {
+			toolCalls[i].Arguments = json.RawMessage("{}")
+		} else {
+			toolCalls[i].Arguments = json.RawMessage(inputs[i])
+		}
+	}
+	return toolCalls
 }
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"localai/database"
+)
+
+const AttachmentsDir = "./attachments"
+
+const MaxAttachmentSize = 20 * 1024 * 1024
+
+var ImageMimeTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// maxInlineDocumentChars bounds how much of an attached document's text is
+// inlined into a message. Longer documents should be indexed for retrieval.
+const maxInlineDocumentChars = 32000
+
+// StoreAttachment saves an uploaded image or document to the attachments
+// directory and records it in the database with its size and SHA-256 hash.
+// Images are recognised by sniffing their content; documents by extension,
+// and their text is extracted once on upload.
+func StoreAttachment(sessionID *string, fileName string, r io.Reader) (*database.Attachment, error) {
+	attachment, err := WriteAttachmentFile(sessionID, fileName, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SaveAttachment(*attachment); err != nil {
+		os.Remove(attachment.Path)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// WriteAttachmentFile does the file half of StoreAttachment and returns the
+// attachment without recording it, for callers that save it in a transaction.
+// The caller removes the file if that save fails.
+func WriteAttachmentFile(sessionID *string, fileName string, r io.Reader) (*database.Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil, fmt.Errorf("file is larger than %d MB", MaxAttachmentSize/(1024*1024))
+	}
+
+	mimeType := http.DetectContentType(data)
+	ext, isImage := ImageMimeTypes[mimeType]
+	if !isImage {
+		ext = strings.ToLower(filepath.Ext(fileName))
+		docType, ok := DocumentMimeType(fileName)
+		if !ok {
+			return nil, fmt.Errorf("unsupported file type: %s", mimeType)
+		}
+		mimeType = docType
+	}
+
+	if err := os.MkdirAll(AttachmentsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create attachments directory: %w", err)
+	}
+
+	id := uuid.New().String()
+	path := filepath.Join(AttachmentsDir, id+ext)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := database.Attachment{
+		ID:        id,
+		SessionID: sessionID,
+		FileName:  filepath.Base(fileName),
+		MimeType:  mimeType,
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Path:      path,
+		CreatedAt: time.Now(),
+	}
+
+	if !isImage {
+		parsed, err := ParseDocument(path)
+		if err != nil {
+			os.Remove(path)
+			return nil, err
+		}
+		attachment.Content = parsed.Content
+		attachment.Pages = parsed.Pages
+		if parsed.Structure != nil {
+			structure, _ := json.Marshal(parsed.Structure)
+			attachment.Structure = string(structure)
+		}
+	}
+
+	return &attachment, nil
+}
+
+// IsDocumentAttachment reports whether an attachment holds extracted text
+// rather than an image.
+func IsDocumentAttachment(a *database.Attachment) bool {
+	_, isImage := ImageMimeTypes[a.MimeType]
+	return !isImage
+}
+
+// DocumentParseResultFor returns the text extracted from a document attachment.
+func DocumentParseResultFor(a *database.Attachment) *DocumentParseResult {
+	result := &DocumentParseResult{
+		Content:  a.Content,
+		FileName: a.FileName,
+		FileType: strings.TrimPrefix(strings.ToLower(filepath.Ext(a.Path)), "."),
+		Pages:    a.Pages,
+	}
+	if parser, ok := DocumentParsers.Get(a.Path); ok {
+		result.FileType = parser.FileType
+	}
+	if a.Structure != "" {
+		json.Unmarshal([]byte(a.Structure), &result.Structure)
+	}
+	return result
+}
+
+// documentAttachmentText renders the text of a message's document attachments
+// for inclusion in the message, each truncated to maxInlineDocumentChars.
+func documentAttachmentText(attachmentIDs []string) string {
+	var sb strings.Builder
+	for _, id := range attachmentIDs {
+		a, err := database.GetAttachment(id)
+		if err != nil || !IsDocumentAttachment(a) {
+			continue
+		}
+		sb.WriteString("\n\n")
+		sb.WriteString(formatDocumentAttachment(a))
+	}
+	return sb.String()
+}
+
+func formatDocumentAttachment(a *database.Attachment) string {
+	content := a.Content
+	if len(content) > maxInlineDocumentChars {
+		cut := maxInlineDocumentChars
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		content = content[:cut] + "\n[... document truncated ...]"
+	}
+	return fmt.Sprintf("[Attached document: %s]\n%s\n[End of %s]", a.FileName, content, a.FileName)
+}
+
+func RemoveAttachment(a *database.Attachment) error {
+	if err := database.DeleteAttachment(a.ID); err != nil {
+		return err
+	}
+	if err := os.Remove(a.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// LoadImagePart reads a stored image attachment as a content part.
+func LoadImagePart(id string) (ContentPart, error) {
+	a, err := database.GetAttachment(id)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("attachment not found: %s", id)
+	}
+	if _, ok := ImageMimeTypes[a.MimeType]; !ok {
+		return ContentPart{}, fmt.Errorf("attachment is not an image: %s", id)
+	}
+
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	return ContentPart{
+		Type:     "image",
+		MimeType: a.MimeType,
+		Data:     base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
+
+// CopyAttachment duplicates a stored attachment for another session so each
+// session can delete its files independently.
+func CopyAttachment(id string, sessionID *string) (*database.Attachment, error) {
+	copied, err := CopyAttachmentFile(id, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.SaveAttachment(*copied); err != nil {
+		os.Remove(copied.Path)
+		return nil, err
+	}
+	return copied, nil
+}
+
+// CopyAttachmentFile duplicates an attachment's file for another session
+// without recording it, for callers that save the copy in a transaction.
+func CopyAttachmentFile(id string, sessionID *string) (*database.Attachment, error) {
+	a, err := database.GetAttachment(id)
+	if err != nil {
+		return nil, fmt.Errorf("attachment not found: %s", id)
+	}
+
+	data, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	copied := *a
+	copied.ID = uuid.New().String()
+	copied.SessionID = sessionID
+	copied.Path = filepath.Join(AttachmentsDir, copied.ID+filepath.Ext(a.Path))
+	copied.CreatedAt = time.Now()
+	if err := os.WriteFile(copied.Path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	return &copied, nil
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// ProviderConcurrency caps how many responses may stream from one provider
+// at a time. A single local Ollama works through requests one by one, so
+// running several at once only makes each of them slower.
+var ProviderConcurrency = map[string]int{
+	"ollama": 1,
+}
+
+// defaultProviderConcurrency applies to providers not in ProviderConcurrency.
+const defaultProviderConcurrency = 4
+
+var (
+	providerSlots   = make(map[string]chan struct{})
+	providerSlotsMu sync.Mutex
+)
+
+// AcquireProviderSlot waits for a free slot on the provider serving modelID
+// and returns the function that frees it. It fails only when ctx is done.
+func AcquireProviderSlot(ctx context.Context, modelID string) (func(), error) {
+	name := modelID
+	if p := Providers.GetForModel(modelID); p != nil {
+		name = p.Name()
+	}
+
+	providerSlotsMu.Lock()
+	slots, ok := providerSlots[name]
+	if !ok {
+		limit, ok := ProviderConcurrency[name]
+		if !ok || limit < 1 {
+			limit = defaultProviderConcurrency
+		}
+		slots = make(chan struct{}, limit)
+		providerSlots[name] = slots
+	}
+	providerSlotsMu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"localai/database"
+)
+
+// DefaultOllamaContext is the num_ctx sent to Ollama when a model does not
+// set its own context size. It is also the window assumed for unknown models.
+const DefaultOllamaContext = 8192
+
+const (
+	defaultMaxOutputTokens = 4096
+	messageOverheadTokens  = 4
+	imageTokens            = 800
+	maxSummaryTokens       = 1024
+)
+
+var knownContextWindows = map[string]int{
+	"anthropic:":                 200000,
+	"gemini:":                    1000000,
+	"gemini:gemini-1.5-pro":      2000000,
+	"openai:gpt-4o":              128000,
+	"openai:gpt-4-turbo":         128000,
+	"openai:gpt-4.1":             1000000,
+	"openai:gpt-4":               8192,
+	"openai:gpt-3.5-turbo":       16385,
+	"openai:o1":                  200000,
+	"openai:o3":                  200000,
+	"openai:o4":                  200000,
+	"deepseek:":                  64000,
+	"groq:":                      128000,
+	"groq:mixtral-8x7b-32768":    32768,
+	"groq:gemma2":                8192,
+	"together:":                  128000,
+	"together:mistralai/Mixtral": 32768,
+	"openrouter:":                32768,
+}
+
+// DefaultContextWindow returns the context window of a model from the
+// longest matching known prefix, falling back to DefaultOllamaContext.
+func DefaultContextWindow(modelID string) int {
+	window := DefaultOllamaContext
+	matched := 0
+	for prefix, tokens := range knownContextWindows {
+		if len(prefix) > matched && strings.HasPrefix(modelID, prefix) {
+			window = tokens
+			matched = len(prefix)
+		}
+	}
+	return window
+}
+
+// ContextWindow returns the window for a configured model. An explicit
+// context_size always wins over the built-in table.
+func ContextWindow(config database.ModelConfig) int {
+	if config.Params.ContextSize > 0 {
+		return config.Params.ContextSize
+	}
+	return DefaultContextWindow(config.ModelID)
+}
+
+// promptBudget is the number of prompt tokens left once room for the reply
+// has been reserved.
+func promptBudget(config database.ModelConfig) int {
+	window := ContextWindow(config)
+	reserve := config.Params.MaxTokens
+	if reserve <= 0 {
+		reserve = defaultMaxOutputTokens
+	}
+	if reserve > window/2 {
+		reserve = window / 2
+	}
+	return window - reserve
+}
+
+// EstimateTokens approximates the token count of text at about four
+// characters per token, which is close enough for budgeting.
+func EstimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func EstimateMessageTokens(m ChatMessage) int {
+	tokens := messageOverheadTokens + EstimateTokens(m.TextContent())
+	for _, p := range m.Parts {
+		if p.Type == "image" {
+			tokens += imageTokens
+		}
+	}
+	for _, tc := range m.ToolCalls {
+		tokens += EstimateTokens(tc.Name) + EstimateTokens(string(tc.Arguments))
+	}
+	return tokens
+}
+
+// historyEntry is a history message converted for one model, remembering
+// where it came from so compaction can drop or summarize it.
+type historyEntry struct {
+	index   int
+	message ChatMessage
+	tokens  int
+	pinned  bool
+}
+
+// fitToContext trims history entries until the prompt fits the model's
+// budget. Pinned entries and the newest entry are always kept; everything
+// else is kept newest-first as a contiguous tail. The dropped entries are
+// summarized when the model uses the summarize strategy.
+func (o *Orchestrator) fitToContext(forModel database.ModelConfig, system ChatMessage, entries []historyEntry, extra []ChatMessage) []ChatMessage {
+	budget := promptBudget(forModel)
+
+	used := EstimateMessageTokens(system)
+	for _, m := range extra {
+		used += EstimateMessageTokens(m)
+	}
+	total := used
+	for _, e := range entries {
+		total += e.tokens
+	}
+	if total <= budget {
+		return assembleMessages(system, entries, extra)
+	}
+
+	strategy := database.CompactionDropOldest
+	if forModel.Context != nil && forModel.Context.Strategy != "" {
+		strategy = forModel.Context.Strategy
+	}
+	summaryTokens := 0
+	if strategy == database.CompactionSummarize {
+		summaryTokens = maxSummaryTokens
+		if summaryTokens > budget/8 {
+			summaryTokens = budget / 8
+		}
+		used += summaryTokens
+	}
+
+	for _, e := range entries {
+		if e.pinned {
+			used += e.tokens
+		}
+	}
+
+	// Walk back from the newest entry until the budget runs out
+	cutoff := len(entries)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].pinned {
+			cutoff = i
+			continue
+		}
+		if used+entries[i].tokens > budget && i < len(entries)-1 {
+			break
+		}
+		used += entries[i].tokens
+		cutoff = i
+	}
+
+	var kept []historyEntry
+	var dropped []database.Message
+	for i, e := range entries {
+		if i >= cutoff || e.pinned {
+			kept = append(kept, e)
+		} else {
+			dropped = append(dropped, o.History[e.index])
+		}
+	}
+	if len(dropped) == 0 {
+		return assembleMessages(system, kept, extra)
+	}
+
+	log.Printf("Compacting context for %s: dropping %d of %d messages (budget %d tokens)", forModel.ModelID, len(dropped), len(entries), budget)
+
+	note := "\n\nSome earlier messages were omitted to fit the context window."
+	if strategy == database.CompactionSummarize {
+		summary, err := o.summarize(forModel, dropped, summaryTokens)
+		if err != nil {
+			log.Printf("Failed to summarize history for %s: %v", forModel.ModelID, err)
+		} else if summary != "" {
+			note = "\n\n## Summary of earlier conversation\n" + summary
+		}
+	}
+	system.Content += note
+
+	return assembleMessages(system, kept, extra)
+}
+
+func assembleMessages(system ChatMessage, entries []historyEntry, extra []ChatMessage) []ChatMessage {
+	messages := make([]ChatMessage, 0, len(entries)+len(extra)+1)
+	messages = append(messages, system)
+	for _, e := range entries {
+		messages = append(messages, e.message)
+	}
+	return append(messages, extra...)
+}
+
+// summarize condenses dropped history with the model's summarizer. Results
+// are cached by the last message they cover so each turn only summarizes
+// what is new since the previous compaction.
+func (o *Orchestrator) summarize(forModel database.ModelConfig, dropped []database.Message, maxTokens int) (string, error) {
+	last := dropped[len(dropped)-1].ID
+	covered := len(dropped)
+
+	// Held across the provider call so concurrent turns do not summarize twice
+	o.summaryMu.Lock()
+	defer o.summaryMu.Unlock()
+	if cached, ok := o.summaries[last]; ok && cached.covered == covered {
+		return cached.text, nil
+	}
+
+	// Reuse the most recent summary that covers a prefix of the dropped messages
+	previous := ""
+	for i := len(dropped) - 2; i >= 0; i-- {
+		if s, ok := o.summaries[dropped[i].ID]; ok && s.covered == i+1 {
+			previous = s.text
+			dropped = dropped[i+1:]
+			break
+		}
+	}
+
+	summarizer := forModel.ModelID
+	if forModel.Context != nil && forModel.Context.SummarizerModel != "" {
+		summarizer = forModel.Context.SummarizerModel
+	}
+
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Summary so far:\n")
+		transcript.WriteString(previous)
+		transcript.WriteString("\n\nNew messages:\n")
+	}
+	for _, m := range dropped {
+		speaker := "User"
+		if m.ModelName != nil {
+			speaker = *m.ModelName
+		}
+		transcript.WriteString(fmt.Sprintf("%s: %s\n\n", speaker, StripMentions(m.Content)))
+	}
+
+	// Keep the newest part of the transcript if it is too long for the summarizer
+	text := transcript.String()
+	limit := (DefaultContextWindow(summarizer) - maxTokens - 256) * 4
+	if limit > 0 && len(text) > limit {
+		cut := len(text) - limit
+		for cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+		text = text[cut:]
+	}
+
+	messages := []ChatMessage{
+		{Role: "system", Content: "You summarize conversations. Write a concise summary of the conversation below, keeping decisions, facts, open questions and code details that later messages may rely on. Reply with the summary only."},
+		{Role: "user", Content: text},
+	}
+	opts := ChatOptions{Params: database.GenerationParams{MaxTokens: maxTokens}}
+
+	var sb strings.Builder
+	_, err := StreamChatToProvider(o.Context(), summarizer, messages, opts, func(chunk string, done bool, tokens int) {
+		sb.WriteString(chunk)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	summary := strings.TrimSpace(sb.String())
+	o.summaries[last] = historySummary{text: summary, covered: covered}
+	return summary, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"localai/database"
+)
+
+// revisedAnswerMarker separates a critique from the revised answer that
+// follows it.
+const revisedAnswerMarker = "REVISED ANSWER:"
+
+var votePattern = regexp.MustCompile(`(?i)VOTE:\s*@?\[?([\w.-]+)`)
+
+func DebateCritiquePrompt(round, total int) string {
+	return fmt.Sprintf("Critique round %d of %d. Point out mistakes, gaps and strong points in the other answers above, "+
+		"then give your complete revised answer after a line that says %s", round, total, revisedAnswerMarker)
+}
+
+// DebateVotePrompt asks forModel to vote for the best answer of another
+// model.
+func (o *Orchestrator) DebateVotePrompt(forModel database.ModelConfig) string {
+	var candidates []string
+	for _, c := range o.ModelConfigs {
+		if c.ShortID != forModel.ShortID {
+			candidates = append(candidates, fmt.Sprintf("@%s (%s)", c.ShortID, c.Name))
+		}
+	}
+	return fmt.Sprintf("Vote for the best final answer in this debate other than your own. Candidates: %s. "+
+		"Reply with \"VOTE: @id\" on the first line, then one sentence explaining why.", strings.Join(candidates, ", "))
+}
+
+func DebateJudgePrompt() string {
+	return "You are the judge of this debate. Considering every answer and critique above, write the single best final answer " +
+		"to the user's question. Resolve disagreements, keep what is correct, and do not describe the debate itself."
+}
+
+// DebateJudge returns the model that synthesizes the final answer: the
+// session model named by JudgeModel, an outside model with that ID, or the
+// first session model.
+func (o *Orchestrator) DebateJudge() database.ModelConfig {
+	judge := o.Debate.JudgeModel
+	for _, c := range o.ModelConfigs {
+		if judge == "" || strings.EqualFold(c.ShortID, judge) {
+			return c
+		}
+	}
+	return database.ModelConfig{
+		ModelID: judge,
+		Name:    "Judge",
+		ShortID: "judge",
+		Role:    database.RoleGeneral,
+	}
+}
+
+// TallyVotes counts votes by voter short ID, ignoring self-votes and votes
+// for unknown models. Ties go to the model listed first in the session. It
+// returns the winner and a summary such as "Planner 2, Coder 1".
+func (o *Orchestrator) TallyVotes(votes map[string]string) (database.ModelConfig, string) {
+	counts := make(map[string]int)
+	for voter, content := range votes {
+		m := votePattern.FindStringSubmatch(content)
+		if m == nil {
+			continue
+		}
+		for _, c := range o.ModelConfigs {
+			if c.ShortID != voter && (strings.EqualFold(c.ShortID, m[1]) || strings.EqualFold(c.Name, m[1])) {
+				counts[c.ShortID]++
+				break
+			}
+		}
+	}
+
+	winner := o.ModelConfigs[0]
+	var parts []string
+	for _, c := range o.ModelConfigs {
+		if counts[c.ShortID] > counts[winner.ShortID] {
+			winner = c
+		}
+		if counts[c.ShortID] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", c.Name, counts[c.ShortID]))
+		}
+	}
+	if len(parts) == 0 {
+		return winner, "no valid votes"
+	}
+	return winner, strings.Join(parts, ", ")
+}
+
+// LatestDebateAnswer returns a model's newest answer to the current
+// question: its last revised answer from a critique, or its first answer.
+func (o *Orchestrator) LatestDebateAnswer(shortID string) string {
+	for i := len(o.History) - 1; i >= 0; i-- {
+		m := o.History[i]
+		if m.Role == "user" {
+			break
+		}
+		if m.ModelID == nil || *m.ModelID != shortID {
+			continue
+		}
+		switch m.Kind {
+		case database.MessageKindCritique:
+			if i := strings.LastIndex(m.Content, revisedAnswerMarker); i >= 0 {
+				return strings.TrimSpace(m.Content[i+len(revisedAnswerMarker):])
+			}
+		case database.MessageKindAnswer:
+			return m.Content
+		}
+	}
+	return ""
+}
@@ -1,121 +1,192 @@
 package services
 
 import (
-	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
-
-	"github.com/ledongthuc/pdf"
-	"github.com/nguyenthenguyen/docx"
+	"sync"
 )
 
 type DocumentParseResult struct {
-	Content  string `json:"content"`
-	FileName string `json:"file_name"`
-	FileType string `json:"file_type"`
-	Pages    int    `json:"pages"`
+	Content   string         `json:"content"`
+	FileName  string         `json:"file_name"`
+	FileType  string         `json:"file_type"`
+	Pages     int            `json:"pages"`
+	Structure []DocumentPage `json:"structure,omitempty"`
 }
 
-func ParseDocument(filePath string) (*DocumentParseResult, error) {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	fileName := filepath.Base(filePath)
+// DocumentPage is one page of a structured parse. Error is set when the page
+// could not be read; the rest of the document is still returned.
+type DocumentPage struct {
+	Number int             `json:"number"`
+	Blocks []DocumentBlock `json:"blocks"`
+	Error  string          `json:"error,omitempty"`
+}
 
-	switch ext {
-	case ".pdf":
-		content, pages, err := ParsePDF(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse PDF: %w", err)
-		}
-		return &DocumentParseResult{
-			Content:  content,
-			FileName: fileName,
-			FileType: "pdf",
-			Pages:    pages,
-		}, nil
-
-	case ".docx":
-		content, err := ParseDOCX(filePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse DOCX: %w", err)
-		}
-		return &DocumentParseResult{
-			Content:  content,
-			FileName: fileName,
-			FileType: "docx",
-			Pages:    0,
-		}, nil
-
-	case ".doc":
-		return nil, fmt.Errorf("legacy .doc format is not supported. Please convert to .docx")
+// DocumentBlock is a heading, paragraph or table. Tables carry their cells in
+// Rows, with the first row as the header.
+type DocumentBlock struct {
+	Type  string     `json:"type"`
+	Level int        `json:"level,omitempty"`
+	Text  string     `json:"text,omitempty"`
+	Rows  [][]string `json:"rows,omitempty"`
+}
 
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
-	}
+// DocumentParseFunc extracts the text of a file as Markdown-flavoured plain
+// text. Formats without pages return 0 pages.
+type DocumentParseFunc func(filePath string) (content string, pages int, err error)
+
+// StructuredParseFunc extracts a file page by page. The flat content is
+// rendered from the pages with RenderDocumentPages.
+type StructuredParseFunc func(filePath string) ([]DocumentPage, error)
+
+// DocumentParser handles one format with either Parse or ParseStructured.
+type DocumentParser struct {
+	FileType        string
+	MimeType        string
+	Parse           DocumentParseFunc
+	ParseStructured StructuredParseFunc
 }
 
-func ParsePDF(filePath string) (string, int, error) {
-	f, r, err := pdf.Open(filePath)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to open PDF: %w", err)
+// DocumentParserRegistry maps lowercase file extensions, including the dot,
+// to parsers.
+type DocumentParserRegistry struct {
+	parsers map[string]DocumentParser
+	mu      sync.RWMutex
+}
+
+func NewDocumentParserRegistry() *DocumentParserRegistry {
+	return &DocumentParserRegistry{
+		parsers: make(map[string]DocumentParser),
 	}
-	defer f.Close()
+}
 
-	totalPages := r.NumPage()
-	var buf bytes.Buffer
+func (r *DocumentParserRegistry) Register(ext string, p DocumentParser) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parsers[strings.ToLower(ext)] = p
+}
 
-	for i := 1; i <= totalPages; i++ {
-		page := r.Page(i)
-		if page.V.IsNull() {
-			continue
-		}
+// Get returns the parser for a file name or path by its extension.
+func (r *DocumentParserRegistry) Get(fileName string) (DocumentParser, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.parsers[strings.ToLower(filepath.Ext(fileName))]
+	return p, ok
+}
 
-		text, err := page.GetPlainText(nil)
-		if err != nil {
-			continue
-		}
+func (r *DocumentParserRegistry) Extensions() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]string, 0, len(r.parsers))
+	for ext := range r.parsers {
+		result = append(result, ext)
+	}
+	sort.Strings(result)
+	return result
+}
 
-		if text != "" {
-			if buf.Len() > 0 {
-				buf.WriteString("\n\n")
-			}
-			buf.WriteString(fmt.Sprintf("--- Page %d ---\n", i))
-			buf.WriteString(text)
-		}
+var DocumentParsers = NewDocumentParserRegistry()
+
+func RegisterBuiltinDocumentParsers() {
+	DocumentParsers.Register(".pdf", DocumentParser{FileType: "pdf", MimeType: "application/pdf", ParseStructured: ParsePDF})
+	DocumentParsers.Register(".docx", DocumentParser{FileType: "docx", MimeType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Parse: ParseDOCX})
+	DocumentParsers.Register(".xlsx", DocumentParser{FileType: "xlsx", MimeType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Parse: ParseXLSX})
+	DocumentParsers.Register(".pptx", DocumentParser{FileType: "pptx", MimeType: "application/vnd.openxmlformats-officedocument.presentationml.presentation", Parse: ParsePPTX})
+	DocumentParsers.Register(".odt", DocumentParser{FileType: "odt", MimeType: "application/vnd.oasis.opendocument.text", Parse: ParseODT})
+	DocumentParsers.Register(".epub", DocumentParser{FileType: "epub", MimeType: "application/epub+zip", Parse: ParseEPUB})
+	DocumentParsers.Register(".rtf", DocumentParser{FileType: "rtf", MimeType: "application/rtf", Parse: ParseRTF})
+
+	for _, ext := range []string{".html", ".htm", ".xhtml"} {
+		DocumentParsers.Register(ext, DocumentParser{FileType: "html", MimeType: "text/html", Parse: ParseHTML})
 	}
+	DocumentParsers.Register(".csv", DocumentParser{FileType: "csv", MimeType: "text/csv", Parse: ParseCSV})
+	DocumentParsers.Register(".tsv", DocumentParser{FileType: "tsv", MimeType: "text/tab-separated-values", Parse: ParseCSV})
+	DocumentParsers.Register(".txt", DocumentParser{FileType: "text", MimeType: "text/plain", Parse: ParseText})
+	for _, ext := range []string{".md", ".markdown"} {
+		DocumentParsers.Register(ext, DocumentParser{FileType: "markdown", MimeType: "text/markdown", Parse: ParseText})
+	}
+	for ext, lang := range codeLanguages {
+		DocumentParsers.Register(ext, DocumentParser{FileType: lang, MimeType: "text/plain", Parse: ParseSourceCode})
+	}
+}
 
-	content := strings.TrimSpace(buf.String())
-	if content == "" {
-		return "", totalPages, fmt.Errorf("no text content found in PDF (may be scanned/image-based)")
+func ParseDocument(filePath string) (*DocumentParseResult, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == ".doc" {
+		return nil, fmt.Errorf("legacy .doc format is not supported. Please convert to .docx")
 	}
 
-	return content, totalPages, nil
-}
+	parser, ok := DocumentParsers.Get(filePath)
+	if !ok {
+		return nil, fmt.Errorf("unsupported file type: %s", ext)
+	}
 
-func ParseDOCX(filePath string) (string, error) {
-	r, err := docx.ReadDocxFile(filePath)
+	result := &DocumentParseResult{
+		FileName: filepath.Base(filePath),
+		FileType: parser.FileType,
+	}
+	var err error
+	if parser.ParseStructured != nil {
+		result.Structure, err = parser.ParseStructured(filePath)
+		result.Content = RenderDocumentPages(result.Structure)
+		result.Pages = len(result.Structure)
+	} else {
+		result.Content, result.Pages, err = parser.Parse(filePath)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to open DOCX: %w", err)
+		return nil, fmt.Errorf("failed to parse %s: %w", strings.ToUpper(strings.TrimPrefix(ext, ".")), err)
+	}
+	if strings.TrimSpace(result.Content) == "" {
+		return nil, fmt.Errorf("no text content found in %s", filepath.Base(filePath))
 	}
-	defer r.Close()
 
-	doc := r.Editable()
-	content := doc.GetContent()
+	return result, nil
+}
 
-	content = strings.TrimSpace(content)
+func IsSupportedDocument(filePath string) bool {
+	_, ok := DocumentParsers.Get(filePath)
+	return ok
+}
+
+// DocumentMimeType returns the MIME type of a supported document.
+func DocumentMimeType(fileName string) (string, bool) {
+	p, ok := DocumentParsers.Get(fileName)
+	return p.MimeType, ok
+}
 
-	if content == "" {
-		return "", fmt.Errorf("no text content found in DOCX")
+// markdownTable renders rows as a Markdown table with the first row as the
+// header. Short rows are padded and pipes in cells are escaped.
+func markdownTable(rows [][]string) string {
+	width := 0
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	if width == 0 {
+		return ""
 	}
 
-	return content, nil
-}
+	var sb strings.Builder
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := 0; i < width; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = strings.Join(strings.Fields(row[i]), " ")
+				cell = strings.ReplaceAll(cell, "|", "\\|")
+			}
+			sb.WriteString(" " + cell + " |")
+		}
+		sb.WriteString("\n")
+	}
 
-func IsSupportedDocument(filePath string) bool {
-	ext := strings.ToLower(filepath.Ext(filePath))
-	supported := map[string]bool{
-		".pdf":  true,
-		".docx": true,
+	writeRow(rows[0])
+	sb.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+	for _, row := range rows[1:] {
+		writeRow(row)
 	}
-	return supported[ext]
+	return strings.TrimRight(sb.String(), "\n")
 }
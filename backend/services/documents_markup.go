@@ -0,0 +1,276 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ParseHTML renders an HTML page as Markdown, keeping headings, lists, code
+// blocks and tables.
+func ParseHTML(filePath string) (string, int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	content, err := htmlToMarkdown(data)
+	return content, 0, err
+}
+
+func htmlToMarkdown(data []byte) (string, error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	c := htmlConverter{out: &sb}
+	if body := findHTMLElement(doc, atom.Body); body != nil {
+		c.children(body)
+	} else {
+		c.children(doc)
+	}
+	return collapseBlankLines(sb.String()), nil
+}
+
+func findHTMLElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findHTMLElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+type htmlConverter struct {
+	out       *strings.Builder
+	listDepth int
+}
+
+func (c *htmlConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.node(child)
+	}
+}
+
+// block writes a paragraph break before and after n's content.
+func (c *htmlConverter) block(prefix string, n *html.Node) {
+	c.out.WriteString("\n\n" + prefix)
+	c.children(n)
+	c.out.WriteString("\n\n")
+}
+
+func (c *htmlConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			if n.Data != "" {
+				c.out.WriteString(" ")
+			}
+			return
+		}
+		if n.Data[0] == ' ' || n.Data[0] == '\n' || n.Data[0] == '\t' {
+			text = " " + text
+		}
+		if last := n.Data[len(n.Data)-1]; last == ' ' || last == '\n' || last == '\t' {
+			text += " "
+		}
+		c.out.WriteString(text)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Noscript, atom.Head, atom.Template, atom.Svg, atom.Iframe:
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		c.out.WriteString("\n\n" + strings.Repeat("#", level) + " " + htmlText(n) + "\n\n")
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Header, atom.Footer, atom.Main, atom.Aside, atom.Nav, atom.Figure, atom.Dl:
+		c.block("", n)
+	case atom.Blockquote:
+		c.out.WriteString("\n\n> " + htmlText(n) + "\n\n")
+	case atom.Br:
+		c.out.WriteString("\n")
+	case atom.Hr:
+		c.out.WriteString("\n\n---\n\n")
+	case atom.Ul, atom.Ol:
+		c.listDepth++
+		if c.listDepth == 1 {
+			c.out.WriteString("\n")
+		}
+		index := 0
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.DataAtom != atom.Li {
+				continue
+			}
+			index++
+			marker := "- "
+			if n.DataAtom == atom.Ol {
+				marker = fmt.Sprintf("%d. ", index)
+			}
+			c.out.WriteString("\n" + strings.Repeat("  ", c.listDepth-1) + marker)
+			c.children(child)
+		}
+		c.out.WriteString("\n")
+		c.listDepth--
+		if c.listDepth == 0 {
+			c.out.WriteString("\n")
+		}
+	case atom.Dt:
+		c.out.WriteString("\n**" + htmlText(n) + "**\n")
+	case atom.Dd:
+		c.out.WriteString(": ")
+		c.children(n)
+		c.out.WriteString("\n")
+	case atom.Pre:
+		code := strings.Trim(htmlRawText(n), "\n")
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		c.out.WriteString("\n\n" + fence + "\n" + code + "\n" + fence + "\n\n")
+	case atom.Code:
+		c.out.WriteString("`" + htmlRawText(n) + "`")
+	case atom.Strong, atom.B:
+		if text := htmlText(n); text != "" {
+			c.out.WriteString("**" + text + "**")
+		}
+	case atom.Em, atom.I:
+		if text := htmlText(n); text != "" {
+			c.out.WriteString("*" + text + "*")
+		}
+	case atom.Img:
+		if alt := htmlAttr(n, "alt"); alt != "" {
+			c.out.WriteString("[image: " + alt + "]")
+		}
+	case atom.Table:
+		var rows [][]string
+		var collect func(*html.Node)
+		collect = func(n *html.Node) {
+			for child := n.FirstChild; child != nil; child = child.NextSibling {
+				if child.Type != html.ElementNode {
+					continue
+				}
+				if child.DataAtom == atom.Table {
+					continue // nested tables are flattened into their cell
+				}
+				if child.DataAtom == atom.Tr {
+					var row []string
+					for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+						if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+							row = append(row, htmlText(cell))
+						}
+					}
+					rows = append(rows, row)
+					continue
+				}
+				collect(child)
+			}
+		}
+		collect(n)
+		if caption := findHTMLElement(n, atom.Caption); caption != nil {
+			c.out.WriteString("\n\n" + htmlText(caption))
+		}
+		c.out.WriteString("\n\n" + markdownTable(rows) + "\n\n")
+	default:
+		c.children(n)
+	}
+}
+
+// htmlText returns the visible text of n on one line.
+func htmlText(n *html.Node) string {
+	return strings.Join(strings.Fields(htmlRawText(n)), " ")
+}
+
+// htmlRawText returns the text of n with whitespace preserved.
+func htmlRawText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Script, atom.Style:
+				return
+			case atom.Br:
+				sb.WriteString("\n")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// ParseEPUB renders the book's chapters in reading order.
+func ParseEPUB(filePath string) (string, int, error) {
+	doc, closeDoc, err := openZipDocument(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeDoc()
+
+	container, err := doc.tree("META-INF/container.xml")
+	if err != nil {
+		return "", 0, err
+	}
+	rootfile := container.find("rootfile")
+	if rootfile == nil || rootfile.Attrs["full-path"] == "" {
+		return "", 0, fmt.Errorf("EPUB has no package document")
+	}
+	opfPath := rootfile.Attrs["full-path"]
+
+	pkg, err := doc.tree(opfPath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	manifest := make(map[string]string)
+	for _, item := range pkg.findAll("item") {
+		manifest[item.Attrs["id"]] = path.Join(path.Dir(opfPath), item.Attrs["href"])
+	}
+
+	var chapters []string
+	for _, ref := range pkg.findAll("itemref") {
+		href, ok := manifest[ref.Attrs["idref"]]
+		if !ok {
+			continue
+		}
+		data, err := doc.read(href)
+		if err != nil {
+			continue
+		}
+		text, err := htmlToMarkdown(data)
+		if err != nil || text == "" {
+			continue
+		}
+		chapters = append(chapters, text)
+	}
+
+	return strings.Join(chapters, "\n\n"), 0, nil
+}
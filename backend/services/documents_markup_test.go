@@ -0,0 +1,47 @@
+package services
+
+import "testing"
+
+func TestHTMLToMarkdown(t *testing.T) {
+	page := `<html><head><title>ignored</title><style>p{}</style></head><body>
+<h2>Title</h2>
+<p>Some <strong>bold</strong> and <em>italic</em> text with <code>x := 1</code>.</p>
+<script>alert(1)</script>
+<ul><li>one</li><li>two<ol><li>nested</li></ol></li></ul>
+<pre>line 1
+  line 2</pre>
+<table><caption>Prices</caption><tr><th>Item</th><th>Cost</th></tr><tr><td>Tea</td><td>2</td></tr></table>
+</body></html>`
+
+	got, err := htmlToMarkdown([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Title\n\nSome **bold** and *italic* text with `x := 1`.\n\n- one\n- two\n  1. nested\n\n```\nline 1\n  line 2\n```\n\nPrices\n\n| Item | Cost |\n| --- | --- |\n| Tea | 2 |"
+	if got != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
+
+func TestParseEPUBSpineOrder(t *testing.T) {
+	filePath := writeZip(t, "book.epub", map[string]string{
+		"META-INF/container.xml": `<container><rootfiles><rootfile full-path="OEBPS/content.opf"/></rootfiles></container>`,
+		"OEBPS/content.opf": `<package><manifest>` +
+			`<item id="c1" href="text/one.xhtml"/><item id="c2" href="text/two.xhtml"/><item id="css" href="style.css"/>` +
+			`</manifest><spine><itemref idref="c2"/><itemref idref="missing"/><itemref idref="c1"/></spine></package>`,
+		"OEBPS/text/one.xhtml": `<html><body><p>Chapter one</p></body></html>`,
+		"OEBPS/text/two.xhtml": `<html><body><p>Chapter two</p></body></html>`,
+	})
+
+	got, _, err := ParseEPUB(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Chapter two\n\nChapter one"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, _, err := ParseEPUB(writeZip(t, "empty.epub", map[string]string{"META-INF/container.xml": `<container/>`})); err == nil {
+		t.Error("expected an error for an EPUB without a package document")
+	}
+}
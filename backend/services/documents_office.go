@@ -0,0 +1,534 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxZipEntrySize bounds how much of one archive member is decompressed, so
+// small uploads can't expand into huge XML documents.
+const maxZipEntrySize = 64 * 1024 * 1024
+
+// relationshipNamespaces are the transitional and strict OOXML namespaces of
+// r:id attributes, plus the bare prefix the decoder keeps when a part forgets
+// to declare it.
+var relationshipNamespaces = []string{
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships",
+	"http://purl.oclc.org/ooxml/officeDocument/relationships",
+	"r",
+}
+
+// xmlNode is a minimal element tree. Names are local names without their
+// namespace prefix, which is enough to walk OOXML and ODF documents. Attrs is
+// keyed by local name too, with unprefixed attributes taking precedence;
+// NSAttrs keeps every attribute under its full name for cases like r:id next
+// to id. Character data is kept in order as children with an empty Name.
+type xmlNode struct {
+	Name     string
+	Attrs    map[string]string
+	NSAttrs  map[xml.Name]string
+	Children []*xmlNode
+	Text     string
+}
+
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Name: t.Name.Local, Attrs: make(map[string]string), NSAttrs: make(map[xml.Name]string)}
+			for _, a := range t.Attr {
+				n.NSAttrs[a.Name] = a.Value
+				if _, ok := n.Attrs[a.Name.Local]; !ok || a.Name.Space == "" {
+					n.Attrs[a.Name.Local] = a.Value
+				}
+			}
+			parent.Children = append(parent.Children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.Children = append(parent.Children, &xmlNode{Text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// relationshipID returns the r:id attribute that links an element to
+// another part of the package.
+func (n *xmlNode) relationshipID() string {
+	for _, ns := range relationshipNamespaces {
+		if id, ok := n.NSAttrs[xml.Name{Space: ns, Local: "id"}]; ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// find returns the first descendant element with the given name.
+func (n *xmlNode) find(name string) *xmlNode {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+		if found := c.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns all descendant elements with the given name, not
+// descending into matches.
+func (n *xmlNode) findAll(name string) []*xmlNode {
+	var result []*xmlNode
+	for _, c := range n.Children {
+		if c.Name == name {
+			result = append(result, c)
+		} else {
+			result = append(result, c.findAll(name)...)
+		}
+	}
+	return result
+}
+
+// innerText returns the character data directly inside n.
+func (n *xmlNode) innerText() string {
+	var sb strings.Builder
+	for _, c := range n.Children {
+		if c.Name == "" {
+			sb.WriteString(c.Text)
+		}
+	}
+	return sb.String()
+}
+
+// textElements are the elements whose character data is document text: OOXML
+// keeps it in <t> runs, ODF directly in paragraphs, headings and spans.
+var textElements = map[string]bool{"t": true, "p": true, "h": true, "span": true, "a": true}
+
+// textContent concatenates the text below n, honouring the tab, break and
+// space elements used by OOXML and ODF.
+func (n *xmlNode) textContent() string {
+	var sb strings.Builder
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			switch c.Name {
+			case "":
+				if !textElements[n.Name] {
+					continue
+				}
+				if n.Name != "t" && strings.TrimSpace(c.Text) == "" && strings.Contains(c.Text, "\n") {
+					continue // indentation between pretty-printed elements
+				}
+				sb.WriteString(c.Text)
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr", "line-break":
+				sb.WriteString("\n")
+			case "s": // ODF run of spaces
+				count, err := strconv.Atoi(c.Attrs["c"])
+				if err != nil || count < 1 {
+					count = 1
+				}
+				sb.WriteString(strings.Repeat(" ", count))
+			case "delText", "instrText", "annotation", "note-citation":
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+type zipDocument struct {
+	files map[string]*zip.File
+}
+
+func openZipDocument(filePath string) (*zipDocument, func() error, error) {
+	r, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	doc := &zipDocument{files: make(map[string]*zip.File)}
+	for _, f := range r.File {
+		doc.files[f.Name] = f
+	}
+	return doc, r.Close, nil
+}
+
+func (d *zipDocument) read(name string) ([]byte, error) {
+	f, ok := d.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in archive", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxZipEntrySize))
+}
+
+func (d *zipDocument) tree(name string) (*xmlNode, error) {
+	data, err := d.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseXMLTree(data)
+}
+
+// relationships maps relationship IDs to targets resolved against dir.
+func (d *zipDocument) relationships(relsPath, dir string) map[string]string {
+	result := make(map[string]string)
+	rels, err := d.tree(relsPath)
+	if err != nil {
+		return result
+	}
+	for _, rel := range rels.findAll("Relationship") {
+		target := rel.Attrs["Target"]
+		if strings.HasPrefix(target, "/") {
+			target = strings.TrimPrefix(target, "/")
+		} else {
+			target = path.Join(dir, target)
+		}
+		result[rel.Attrs["Id"]] = target
+	}
+	return result
+}
+
+// ParseDOCX renders a Word document as Markdown: heading styles become
+// headings, list paragraphs become bullets and tables become Markdown tables.
+func ParseDOCX(filePath string) (string, int, error) {
+	doc, closeDoc, err := openZipDocument(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeDoc()
+
+	root, err := doc.tree("word/document.xml")
+	if err != nil {
+		return "", 0, err
+	}
+	body := root.find("body")
+	if body == nil {
+		return "", 0, fmt.Errorf("document has no body")
+	}
+
+	var blocks []string
+	var walk func(*xmlNode)
+	walk = func(n *xmlNode) {
+		for _, c := range n.Children {
+			switch c.Name {
+			case "p":
+				if text := docxParagraph(c); text != "" {
+					blocks = append(blocks, text)
+				}
+			case "tbl":
+				blocks = append(blocks, markdownTable(officeTableRows(c, "tr", "tc", "p")))
+			case "sdt", "sdtContent", "customXml", "ins", "smartTag":
+				walk(c)
+			}
+		}
+	}
+	walk(body)
+
+	return strings.Join(blocks, "\n\n"), 0, nil
+}
+
+func docxParagraph(p *xmlNode) string {
+	text := strings.TrimSpace(p.textContent())
+	if text == "" {
+		return ""
+	}
+
+	props := p.find("pPr")
+	if props == nil {
+		return text
+	}
+	if style := props.find("pStyle"); style != nil {
+		name := strings.ToLower(style.Attrs["val"])
+		if name == "title" {
+			return "# " + text
+		}
+		if level, err := strconv.Atoi(strings.TrimPrefix(name, "heading")); err == nil && strings.HasPrefix(name, "heading") && level >= 1 && level <= 6 {
+			return strings.Repeat("#", level) + " " + text
+		}
+	}
+	if props.find("numPr") != nil {
+		return "- " + text
+	}
+	return text
+}
+
+// officeTableRows collects table cell text. Paragraphs inside a cell are
+// joined with spaces so each row stays on one line.
+func officeTableRows(table *xmlNode, rowName, cellName, paragraphName string) [][]string {
+	var rows [][]string
+	for _, tr := range table.findAll(rowName) {
+		var row []string
+		for _, tc := range tr.findAll(cellName) {
+			var parts []string
+			for _, p := range tc.findAll(paragraphName) {
+				if text := strings.TrimSpace(p.textContent()); text != "" {
+					parts = append(parts, text)
+				}
+			}
+			row = append(row, strings.Join(parts, " "))
+			if repeat, err := strconv.Atoi(tc.Attrs["number-columns-repeated"]); err == nil && repeat > 1 && repeat < 64 {
+				for i := 1; i < repeat; i++ {
+					row = append(row, row[len(row)-1])
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// ParseXLSX renders each worksheet as a Markdown table under a heading with
+// the sheet name.
+func ParseXLSX(filePath string) (string, int, error) {
+	doc, closeDoc, err := openZipDocument(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeDoc()
+
+	workbook, err := doc.tree("xl/workbook.xml")
+	if err != nil {
+		return "", 0, err
+	}
+	rels := doc.relationships("xl/_rels/workbook.xml.rels", "xl")
+
+	var sharedStrings []string
+	if sst, err := doc.tree("xl/sharedStrings.xml"); err == nil {
+		for _, si := range sst.findAll("si") {
+			sharedStrings = append(sharedStrings, si.textContent())
+		}
+	}
+
+	var sections []string
+	for _, sheet := range workbook.findAll("sheet") {
+		target, ok := rels[sheet.relationshipID()]
+		if !ok {
+			continue
+		}
+		root, err := doc.tree(target)
+		if err != nil {
+			continue
+		}
+
+		var rows [][]string
+		for _, row := range root.findAll("row") {
+			var cells []string
+			for _, c := range row.findAll("c") {
+				col := xlsxColumn(c.Attrs["r"])
+				if col < 0 {
+					col = len(cells)
+				}
+				for len(cells) <= col {
+					cells = append(cells, "")
+				}
+				cells[col] = xlsxCellValue(c, sharedStrings)
+			}
+			if strings.TrimSpace(strings.Join(cells, "")) != "" {
+				rows = append(rows, cells)
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		sections = append(sections, fmt.Sprintf("## Sheet: %s\n\n%s", sheet.Attrs["name"], markdownTable(rows)))
+	}
+
+	return strings.Join(sections, "\n\n"), 0, nil
+}
+
+// xlsxColumn converts a cell reference such as "BC12" to a zero-based column.
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		n++
+	}
+	if n == 0 || col > 16384 {
+		return -1
+	}
+	return col - 1
+}
+
+func xlsxCellValue(c *xmlNode, sharedStrings []string) string {
+	switch c.Attrs["t"] {
+	case "s":
+		if v := c.find("v"); v != nil {
+			if i, err := strconv.Atoi(strings.TrimSpace(v.innerText())); err == nil && i >= 0 && i < len(sharedStrings) {
+				return sharedStrings[i]
+			}
+		}
+		return ""
+	case "inlineStr":
+		if is := c.find("is"); is != nil {
+			return is.textContent()
+		}
+		return ""
+	case "b":
+		if v := c.find("v"); v != nil && strings.TrimSpace(v.innerText()) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	if v := c.find("v"); v != nil {
+		return strings.TrimSpace(v.innerText())
+	}
+	return ""
+}
+
+// ParsePPTX renders slides in presentation order under "## Slide N" headings,
+// with tables as Markdown. It returns the slide count as the page count.
+func ParsePPTX(filePath string) (string, int, error) {
+	doc, closeDoc, err := openZipDocument(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeDoc()
+
+	var slides []string
+	if presentation, err := doc.tree("ppt/presentation.xml"); err == nil {
+		rels := doc.relationships("ppt/_rels/presentation.xml.rels", "ppt")
+		for _, id := range presentation.findAll("sldId") {
+			if target, ok := rels[id.relationshipID()]; ok {
+				slides = append(slides, target)
+			}
+		}
+	}
+	if len(slides) == 0 {
+		// Fall back to file order when the presentation part is unreadable
+		for name := range doc.files {
+			if strings.HasPrefix(name, "ppt/slides/slide") && strings.HasSuffix(name, ".xml") {
+				slides = append(slides, name)
+			}
+		}
+		sort.Slice(slides, func(i, j int) bool {
+			return slideNumber(slides[i]) < slideNumber(slides[j])
+		})
+	}
+
+	var sections []string
+	for i, name := range slides {
+		root, err := doc.tree(name)
+		if err != nil {
+			continue
+		}
+
+		var blocks []string
+		var walk func(*xmlNode)
+		walk = func(n *xmlNode) {
+			for _, c := range n.Children {
+				switch c.Name {
+				case "tbl":
+					blocks = append(blocks, markdownTable(officeTableRows(c, "tr", "tc", "p")))
+				case "p":
+					if text := strings.TrimSpace(c.textContent()); text != "" {
+						blocks = append(blocks, text)
+					}
+				default:
+					walk(c)
+				}
+			}
+		}
+		walk(root)
+
+		section := fmt.Sprintf("## Slide %d", i+1)
+		if len(blocks) > 0 {
+			section += "\n\n" + strings.Join(blocks, "\n")
+		}
+		sections = append(sections, section)
+	}
+
+	return strings.Join(sections, "\n\n"), len(slides), nil
+}
+
+func slideNumber(name string) int {
+	n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "ppt/slides/slide"), ".xml"))
+	return n
+}
+
+// ParseODT renders an OpenDocument text file as Markdown with headings, list
+// items and tables.
+func ParseODT(filePath string) (string, int, error) {
+	doc, closeDoc, err := openZipDocument(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeDoc()
+
+	root, err := doc.tree("content.xml")
+	if err != nil {
+		return "", 0, err
+	}
+	body := root.find("text")
+	if body == nil {
+		return "", 0, fmt.Errorf("document has no text body")
+	}
+
+	var blocks []string
+	var walk func(n *xmlNode, inList bool)
+	walk = func(n *xmlNode, inList bool) {
+		for _, c := range n.Children {
+			switch c.Name {
+			case "h":
+				level, err := strconv.Atoi(c.Attrs["outline-level"])
+				if err != nil || level < 1 || level > 6 {
+					level = 1
+				}
+				if text := strings.TrimSpace(c.textContent()); text != "" {
+					blocks = append(blocks, strings.Repeat("#", level)+" "+text)
+				}
+			case "p":
+				if text := strings.TrimSpace(c.textContent()); text != "" {
+					if inList {
+						text = "- " + text
+					}
+					blocks = append(blocks, text)
+				}
+			case "list":
+				walk(c, true)
+			case "table":
+				blocks = append(blocks, markdownTable(officeTableRows(c, "table-row", "table-cell", "p")))
+			case "section", "list-item", "list-header":
+				walk(c, inList)
+			}
+		}
+	}
+	walk(body, false)
+
+	return strings.Join(blocks, "\n\n"), 0, nil
+}
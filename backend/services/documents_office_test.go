@@ -0,0 +1,174 @@
+package services
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeZip stores files in a zip archive in a temporary directory and
+// returns its path.
+func writeZip(t *testing.T, name string, files map[string]string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestParseXMLTreeNamespacedAttributes(t *testing.T) {
+	for _, data := range []string{
+		`<p:sldId xmlns:p="urn:p" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" id="256" r:id="rId2"/>`,
+		`<p:sldId xmlns:p="urn:p" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:id="rId2" id="256"/>`,
+	} {
+		root, err := parseXMLTree([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := root.find("sldId")
+		if got := n.Attrs["id"]; got != "256" {
+			t.Errorf("Attrs[id] = %q, want 256 for %s", got, data)
+		}
+		if got := n.relationshipID(); got != "rId2" {
+			t.Errorf("relationshipID() = %q, want rId2 for %s", got, data)
+		}
+	}
+}
+
+const pptxRelsNS = `xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+func pptxSlide(text string) string {
+	return `<p:sld xmlns:p="urn:p" xmlns:a="urn:a"><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`
+}
+
+func TestParsePPTXSlideOrder(t *testing.T) {
+	// Slides are listed out of file-name order, with r:id before id
+	filePath := writeZip(t, "deck.pptx", map[string]string{
+		"ppt/presentation.xml": `<p:presentation xmlns:p="urn:p" ` + pptxRelsNS + `><p:sldIdLst>` +
+			`<p:sldId r:id="rId3" id="256"/><p:sldId r:id="rId2" id="257"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="urn:rels">` +
+			`<Relationship Id="rId2" Target="slides/slide1.xml"/><Relationship Id="rId3" Target="slides/slide2.xml"/></Relationships>`,
+		"ppt/slides/slide1.xml": pptxSlide("Second"),
+		"ppt/slides/slide2.xml": pptxSlide("First"),
+	})
+
+	text, pages, err := ParsePPTX(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages != 2 {
+		t.Errorf("pages = %d, want 2", pages)
+	}
+	want := "## Slide 1\n\nFirst\n\n## Slide 2\n\nSecond"
+	if text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[string]int{
+		"A1":   0,
+		"Z9":   25,
+		"AA3":  26,
+		"BC12": 54,
+		"XFD1": 16383,
+		"XFE1": -1,
+		"12":   -1,
+		"":     -1,
+		"a1":   -1,
+		"AB":   27,
+	}
+	for ref, want := range tests {
+		if got := xlsxColumn(ref); got != want {
+			t.Errorf("xlsxColumn(%q) = %d, want %d", ref, got, want)
+		}
+	}
+}
+
+func TestParseXLSX(t *testing.T) {
+	filePath := writeZip(t, "book.xlsx", map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="urn:main" ` + pptxRelsNS + `><sheets>` +
+			`<sheet name="Stock" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="urn:rels">` +
+			`<Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="urn:main"><si><t>Item</t></si><si><t>Qty</t></si>` +
+			`<si><r><t>Red </t></r><r><t>apple</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet xmlns="urn:main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="D1" t="inlineStr"><is><t>In stock</t></is></c></row>` +
+			`<row r="2"><c r="A2" t="s"><v>2</v></c><c r="B2"><v>12</v></c><c r="D2" t="b"><v>1</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>99</v></c></row>` +
+			`</sheetData></worksheet>`,
+	})
+
+	got, _, err := ParseXLSX(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Sheet: Stock\n\n| Item | Qty |  | In stock |\n| --- | --- | --- | --- |\n| Red apple | 12 |  | TRUE |"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseDOCX(t *testing.T) {
+	const w = `xmlns:w="urn:w"`
+	filePath := writeZip(t, "doc.docx", map[string]string{
+		"word/document.xml": `<w:document ` + w + `><w:body>` +
+			`<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Report</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Results</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t xml:space="preserve">Plain </w:t></w:r><w:r><w:t>text</w:t><w:tab/><w:t>tabbed</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>Point</w:t></w:r></w:p>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>A</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>B</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>1</w:t></w:r></w:p><w:p><w:r><w:t>more</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:delText>gone</w:delText></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`</w:body></w:document>`,
+	})
+
+	got, _, err := ParseDOCX(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Report\n\n## Results\n\nPlain text\ttabbed\n\n- Point\n\n| A | B |\n| --- | --- |\n| 1 more |  |"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestParseODT(t *testing.T) {
+	const ns = `xmlns:office="urn:office" xmlns:text="urn:text" xmlns:table="urn:table"`
+	filePath := writeZip(t, "doc.odt", map[string]string{
+		"content.xml": `<office:document-content ` + ns + `><office:body><office:text>` +
+			`<text:h text:outline-level="2">Intro</text:h>` +
+			`<text:p>Two<text:s text:c="2"/>spaces</text:p>` +
+			`<text:list><text:list-item><text:p>First</text:p></text:list-item></text:list>` +
+			`<table:table><table:table-row><table:table-cell><text:p>x</text:p></table:table-cell>` +
+			`<table:table-cell><text:p>y</text:p></table:table-cell></table:table-row></table:table>` +
+			`</office:text></office:body></office:document-content>`,
+	})
+
+	got, _, err := ParseODT(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "## Intro\n\nTwo  spaces\n\n- First\n\n| x | y |\n| --- | --- |"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// ParsePDF extracts every page as blocks in reading order: text runs are
+// grouped into lines by position, lines into headings, paragraphs and tables,
+// and two-column layouts are read one column at a time. Pages that fail to
+// parse are returned with their error instead of being dropped.
+func ParsePDF(filePath string) ([]DocumentPage, error) {
+	f, r, err := pdf.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer f.Close()
+
+	var pages []DocumentPage
+	hasText := false
+	for i := 1; i <= r.NumPage(); i++ {
+		page := parsePDFPage(r, i)
+		if len(page.Blocks) > 0 {
+			hasText = true
+		}
+		pages = append(pages, page)
+	}
+
+	if !hasText {
+		for _, p := range pages {
+			if p.Error != "" {
+				return pages, fmt.Errorf("page %d: %s", p.Number, p.Error)
+			}
+		}
+		return pages, fmt.Errorf("no text content found in PDF (may be scanned/image-based)")
+	}
+	return pages, nil
+}
+
+func parsePDFPage(r *pdf.Reader, number int) (page DocumentPage) {
+	page.Number = number
+
+	// The PDF library panics on malformed content streams
+	defer func() {
+		if rec := recover(); rec != nil {
+			page.Blocks = nil
+			page.Error = fmt.Sprint(rec)
+		}
+	}()
+
+	p := r.Page(number)
+	if p.V.IsNull() {
+		page.Error = "page not found"
+		return page
+	}
+
+	width := 0.0
+	if box := p.V.Key("MediaBox"); box.Len() == 4 {
+		width = box.Index(2).Float64() - box.Index(0).Float64()
+	}
+
+	lines := pdfLines(p.Content().Text)
+	page.Blocks = pdfBlocks(pdfReadingOrder(lines, width))
+	return page
+}
+
+type pdfSegment struct {
+	x0, x1 float64
+	text   string
+}
+
+// pdfLine is a row of text sharing a baseline, split into segments wherever
+// the horizontal gap is wide enough to separate table cells or columns.
+type pdfLine struct {
+	y, size  float64
+	segments []pdfSegment
+}
+
+func (l pdfLine) x0() float64 { return l.segments[0].x0 }
+func (l pdfLine) x1() float64 { return l.segments[len(l.segments)-1].x1 }
+
+func (l pdfLine) text() string {
+	parts := make([]string, len(l.segments))
+	for i, s := range l.segments {
+		parts[i] = s.text
+	}
+	return strings.Join(parts, " ")
+}
+
+// pdfLines groups glyphs into lines, top to bottom.
+func pdfLines(glyphs []pdf.Text) []pdfLine {
+	var chars []pdf.Text
+	for _, g := range glyphs {
+		if g.S == "" {
+			continue
+		}
+		if g.W <= 0 {
+			g.W = 0.5 * g.FontSize // fonts without width tables
+		}
+		chars = append(chars, g)
+	}
+	sort.SliceStable(chars, func(i, j int) bool {
+		return chars[i].Y > chars[j].Y
+	})
+
+	var lines []pdfLine
+	for start := 0; start < len(chars); {
+		y := chars[start].Y
+		tolerance := math.Max(chars[start].FontSize, 1) * 0.4
+		end := start
+		for end < len(chars) && math.Abs(chars[end].Y-y) <= tolerance {
+			end++
+		}
+		if line := buildPDFLine(chars[start:end]); len(line.segments) > 0 {
+			lines = append(lines, line)
+		}
+		start = end
+	}
+	return lines
+}
+
+func buildPDFLine(chars []pdf.Text) pdfLine {
+	sort.SliceStable(chars, func(i, j int) bool {
+		return chars[i].X < chars[j].X
+	})
+
+	line := pdfLine{y: chars[0].Y}
+	var current *pdfSegment
+	var sb strings.Builder
+	prevEnd := 0.0
+	space := false // space glyphs matter for fonts without widths, where gaps are lost
+	for _, ch := range chars {
+		if strings.TrimSpace(ch.S) == "" {
+			space = current != nil
+			continue
+		}
+		line.size = math.Max(line.size, ch.FontSize)
+		size := math.Max(ch.FontSize, 1)
+		gap := ch.X - prevEnd
+
+		if current == nil || gap > 1.5*size {
+			if current != nil {
+				current.text = sb.String()
+				line.segments = append(line.segments, *current)
+				sb.Reset()
+			}
+			current = &pdfSegment{x0: ch.X}
+		} else if space || gap > 0.15*size {
+			sb.WriteString(" ")
+		}
+		space = false
+		sb.WriteString(ch.S)
+		current.x1 = ch.X + ch.W
+		prevEnd = current.x1
+	}
+	if current == nil {
+		return pdfLine{}
+	}
+	current.text = sb.String()
+	line.segments = append(line.segments, *current)
+	return line
+}
+
+// pdfReadingOrder detects a two-column layout by looking for a vertical
+// gutter that most lines leave empty, and reorders the lines so the left
+// column is read before the right. Lines crossing the gutter, such as titles,
+// stay in place and separate the column runs.
+func pdfReadingOrder(lines []pdfLine, width float64) []pdfLine {
+	if len(lines) < 8 {
+		return lines
+	}
+	if width <= 0 {
+		for _, l := range lines {
+			width = math.Max(width, l.x1())
+		}
+	}
+
+	crosses := func(l pdfLine, g float64) bool {
+		for _, s := range l.segments {
+			if s.x0 < g && s.x1 > g {
+				return true
+			}
+		}
+		return false
+	}
+
+	gutter, best := 0.0, 0
+	for g := width * 0.35; g <= width*0.65; g += 2 {
+		both := 0
+		for _, l := range lines {
+			if !crosses(l, g) && l.x0() < g && l.x1() > g {
+				both++
+			}
+		}
+		if both > best {
+			gutter, best = g, both
+		}
+	}
+	if best < len(lines)/2 {
+		return lines
+	}
+
+	// Tables also leave gutters; a column layout has wide runs of text on
+	// both sides
+	var leftWidths, rightWidths []float64
+	for _, l := range lines {
+		if crosses(l, gutter) {
+			continue
+		}
+		for _, s := range l.segments {
+			if s.x1 <= gutter {
+				leftWidths = append(leftWidths, s.x1-s.x0)
+			} else {
+				rightWidths = append(rightWidths, s.x1-s.x0)
+			}
+		}
+	}
+	if median(leftWidths) < width*0.25 || median(rightWidths) < width*0.25 {
+		return lines
+	}
+
+	var ordered, left, right []pdfLine
+	flush := func() {
+		ordered = append(ordered, left...)
+		ordered = append(ordered, right...)
+		left, right = nil, nil
+	}
+	for _, l := range lines {
+		if crosses(l, gutter) {
+			flush()
+			ordered = append(ordered, l)
+			continue
+		}
+		var l0, r0 []pdfSegment
+		for _, s := range l.segments {
+			if s.x1 <= gutter {
+				l0 = append(l0, s)
+			} else {
+				r0 = append(r0, s)
+			}
+		}
+		if len(l0) > 0 {
+			left = append(left, pdfLine{y: l.y, size: l.size, segments: l0})
+		}
+		if len(r0) > 0 {
+			right = append(right, pdfLine{y: l.y, size: l.size, segments: r0})
+		}
+	}
+	flush()
+	return ordered
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// pdfBlocks turns lines into headings, paragraphs and tables. Headings are
+// lines noticeably larger than the page's body text.
+func pdfBlocks(lines []pdfLine) []DocumentBlock {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	weights := make(map[float64]int)
+	for _, l := range lines {
+		weights[math.Round(l.size*2)/2] += len(l.text())
+	}
+	bodySize, bestWeight := 0.0, -1
+	for size, w := range weights {
+		if w > bestWeight || (w == bestWeight && size < bodySize) {
+			bodySize, bestWeight = size, w
+		}
+	}
+
+	isHeading := func(l pdfLine) bool {
+		return bodySize > 0 && l.size >= bodySize*1.2 && len(l.text()) <= 150
+	}
+
+	var blocks []DocumentBlock
+	for i := 0; i < len(lines); {
+		l := lines[i]
+
+		if len(l.segments) > 1 {
+			if rows, n := pdfTable(lines[i:]); n > 0 {
+				blocks = append(blocks, DocumentBlock{Type: "table", Rows: rows})
+				i += n
+				continue
+			}
+		}
+
+		if isHeading(l) {
+			text := l.text()
+			j := i + 1
+			for j < len(lines) && isHeading(lines[j]) && math.Abs(lines[j].size-l.size) < 0.5 && l.y-lines[j].y < l.size*1.6*float64(j-i) {
+				text += " " + lines[j].text()
+				j++
+			}
+			level := 3
+			if ratio := l.size / bodySize; ratio >= 1.8 {
+				level = 1
+			} else if ratio >= 1.4 {
+				level = 2
+			}
+			blocks = append(blocks, DocumentBlock{Type: "heading", Level: level, Text: text})
+			i = j
+			continue
+		}
+
+		text := l.text()
+		j := i + 1
+		for j < len(lines) {
+			next, prev := lines[j], lines[j-1]
+			gap := prev.y - next.y
+			if gap <= 0 || gap > 1.6*math.Max(prev.size, next.size) || isHeading(next) || math.Abs(next.size-prev.size) > 1 {
+				break
+			}
+			if len(next.segments) > 1 {
+				if _, n := pdfTable(lines[j:]); n > 0 {
+					break
+				}
+			}
+			text = joinPDFLines(text, next.text())
+			j++
+		}
+		blocks = append(blocks, DocumentBlock{Type: "paragraph", Text: text})
+		i = j
+	}
+	return blocks
+}
+
+// joinPDFLines joins wrapped lines, undoing hyphenation at the line break.
+func joinPDFLines(a, b string) string {
+	if strings.HasSuffix(a, "-") && len(a) > 1 {
+		first := []rune(b)
+		prev := []rune(a)
+		if len(first) > 0 && unicode.IsLower(first[0]) && unicode.IsLetter(prev[len(prev)-2]) {
+			return a[:len(a)-1] + b
+		}
+	}
+	return a + " " + b
+}
+
+// pdfTable checks whether lines start with a table: at least two consecutive
+// lines of several segments whose x ranges fall into shared columns. It
+// returns the rows and the number of lines used.
+func pdfTable(lines []pdfLine) ([][]string, int) {
+	n := 0
+	for n < len(lines) && len(lines[n].segments) > 1 {
+		if n > 0 {
+			gap := lines[n-1].y - lines[n].y
+			if gap <= 0 || gap > 3*math.Max(lines[n].size, 1) {
+				break
+			}
+		}
+		n++
+	}
+	if n < 2 {
+		return nil, 0
+	}
+	run := lines[:n]
+
+	// Columns are the merged x ranges of all segments in the run
+	type column struct{ x0, x1 float64 }
+	var spans []column
+	for _, l := range run {
+		for _, s := range l.segments {
+			spans = append(spans, column{s.x0, s.x1})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].x0 < spans[j].x0 })
+	var columns []column
+	for _, s := range spans {
+		if len(columns) > 0 && s.x0 <= columns[len(columns)-1].x1+2 {
+			columns[len(columns)-1].x1 = math.Max(columns[len(columns)-1].x1, s.x1)
+			continue
+		}
+		columns = append(columns, s)
+	}
+	if len(columns) < 2 {
+		return nil, 0
+	}
+
+	rows := make([][]string, len(run))
+	for i, l := range run {
+		row := make([]string, len(columns))
+		for _, s := range l.segments {
+			mid := (s.x0 + s.x1) / 2
+			for c, col := range columns {
+				if mid >= col.x0 && mid <= col.x1 {
+					if row[c] != "" {
+						row[c] += " "
+					}
+					row[c] += s.text
+					break
+				}
+			}
+		}
+		rows[i] = row
+	}
+	return rows, n
+}
+
+// RenderDocumentPages flattens structured pages into text with the
+// "--- Page N ---" markers used for citations. Headings become Markdown
+// headings and tables Markdown tables. Pages that failed are kept with a note
+// so readers know text is missing.
+func RenderDocumentPages(pages []DocumentPage) string {
+	var sections []string
+	for _, p := range pages {
+		if len(p.Blocks) == 0 && p.Error == "" {
+			continue
+		}
+		parts := []string{fmt.Sprintf("--- Page %d ---", p.Number)}
+		if p.Error != "" {
+			parts = append(parts, fmt.Sprintf("[page %d could not be read: %s]", p.Number, p.Error))
+		}
+		for _, b := range p.Blocks {
+			switch b.Type {
+			case "heading":
+				parts = append(parts, strings.Repeat("#", b.Level)+" "+b.Text)
+			case "table":
+				parts = append(parts, markdownTable(b.Rows))
+			default:
+				parts = append(parts, b.Text)
+			}
+		}
+		sections = append(sections, strings.Join(parts, "\n\n"))
+	}
+	return strings.Join(sections, "\n\n")
+}
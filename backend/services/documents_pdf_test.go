@@ -0,0 +1,175 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfRun lays text out as glyphs starting at x, each half the font size wide.
+func pdfRun(x, y, size float64, text string) []pdf.Text {
+	var glyphs []pdf.Text
+	for _, r := range text {
+		glyphs = append(glyphs, pdf.Text{FontSize: size, X: x, Y: y, W: size / 2, S: string(r)})
+		x += size / 2
+	}
+	return glyphs
+}
+
+// testPDFLine builds a line from segments given as x positions and text.
+func testPDFLine(y, size float64, segments ...interface{}) pdfLine {
+	line := pdfLine{y: y, size: size}
+	for i := 0; i < len(segments); i += 2 {
+		x := segments[i].(float64)
+		text := segments[i+1].(string)
+		line.segments = append(line.segments, pdfSegment{x0: x, x1: x + float64(len(text))*size/2, text: text})
+	}
+	return line
+}
+
+func lineTexts(lines []pdfLine) []string {
+	var texts []string
+	for _, l := range lines {
+		texts = append(texts, l.text())
+	}
+	return texts
+}
+
+func TestPDFLines(t *testing.T) {
+	var glyphs []pdf.Text
+	// Runs arrive out of order and with a slightly wobbly baseline
+	glyphs = append(glyphs, pdfRun(80, 700.5, 10, "world")...)
+	glyphs = append(glyphs, pdfRun(50, 680, 10, "second line")...)
+	glyphs = append(glyphs, pdfRun(50, 700, 10, "hello ")...)
+	glyphs = append(glyphs, pdfRun(300, 700, 10, "cell")...)
+	glyphs = append(glyphs, pdf.Text{FontSize: 10, X: 400, Y: 700, S: ""})
+
+	lines := pdfLines(glyphs)
+	if got, want := lineTexts(lines), []string{"hello world cell", "second line"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if n := len(lines[0].segments); n != 2 {
+		t.Errorf("first line has %d segments, want 2 split at the wide gap", n)
+	}
+	if lines[0].size != 10 {
+		t.Errorf("line size = %v, want 10", lines[0].size)
+	}
+
+	// Glyphs without widths fall back to half the font size
+	noWidth := []pdf.Text{{FontSize: 10, X: 0, Y: 0, S: "a"}, {FontSize: 10, X: 5, Y: 0, S: "b"}}
+	if got := lineTexts(pdfLines(noWidth)); !reflect.DeepEqual(got, []string{"ab"}) {
+		t.Errorf("zero-width glyphs = %q", got)
+	}
+}
+
+func TestJoinPDFLines(t *testing.T) {
+	tests := []struct{ a, b, want string }{
+		{"a wrapped", "line", "a wrapped line"},
+		{"hyphen-", "ated word", "hyphenated word"},
+		{"well-", "Known", "well- Known"},
+		{"2019-", "2020", "2019- 2020"},
+		{"-", "x", "- x"},
+	}
+	for _, tt := range tests {
+		if got := joinPDFLines(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinPDFLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestPDFTable(t *testing.T) {
+	lines := []pdfLine{
+		testPDFLine(700, 10, 50.0, "Name", 200.0, "Qty"),
+		testPDFLine(688, 10, 50.0, "Apples", 200.0, "3"),
+		testPDFLine(676, 10, 50.0, "Pears", 205.0, "12"),
+		testPDFLine(664, 10, 50.0, "A paragraph after the table"),
+	}
+	rows, n := pdfTable(lines)
+	if n != 3 {
+		t.Fatalf("table used %d lines, want 3", n)
+	}
+	want := [][]string{{"Name", "Qty"}, {"Apples", "3"}, {"Pears", "12"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+
+	// A single multi-segment line is not a table
+	if _, n := pdfTable(lines[2:]); n != 0 {
+		t.Errorf("single line detected as a table of %d lines", n)
+	}
+	// Neither are lines too far apart
+	far := []pdfLine{lines[0], testPDFLine(500, 10, 50.0, "x", 200.0, "y")}
+	if _, n := pdfTable(far); n != 0 {
+		t.Errorf("distant lines detected as a table of %d lines", n)
+	}
+}
+
+func TestPDFBlocks(t *testing.T) {
+	lines := []pdfLine{
+		testPDFLine(760, 20, 50.0, "Annual"),
+		testPDFLine(736, 20, 50.0, "Report"),
+		testPDFLine(700, 10, 50.0, "The results were en-"),
+		testPDFLine(688, 10, 50.0, "couraging this year and"),
+		testPDFLine(676, 10, 50.0, "beat every forecast."),
+		testPDFLine(650, 13, 50.0, "Details"),
+		testPDFLine(630, 10, 50.0, "Item", 200.0, "Cost"),
+		testPDFLine(618, 10, 50.0, "Tea", 200.0, "2"),
+		testPDFLine(590, 10, 50.0, "Closing words."),
+	}
+	want := []DocumentBlock{
+		{Type: "heading", Level: 1, Text: "Annual Report"},
+		{Type: "paragraph", Text: "The results were encouraging this year and beat every forecast."},
+		{Type: "heading", Level: 3, Text: "Details"},
+		{Type: "table", Rows: [][]string{{"Item", "Cost"}, {"Tea", "2"}}},
+		{Type: "paragraph", Text: "Closing words."},
+	}
+	if got := pdfBlocks(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %+v\nwant %+v", got, want)
+	}
+	if pdfBlocks(nil) != nil {
+		t.Error("no lines should give no blocks")
+	}
+}
+
+func TestPDFReadingOrder(t *testing.T) {
+	lines := []pdfLine{testPDFLine(760, 10, 50.0, "A title that spans both of the page columns here")}
+	for i := 0; i < 8; i++ {
+		y := 740 - float64(i)*12
+		lines = append(lines, testPDFLine(y, 10, 20.0, "left column text that is quite long", 320.0, "right column text that is also long"))
+	}
+	lines[1].segments[0].text = "left first"
+	lines[1].segments[1].text = "right first"
+
+	ordered := pdfReadingOrder(lines, 600)
+	if len(ordered) != 17 {
+		t.Fatalf("got %d lines, want the title and 16 column lines", len(ordered))
+	}
+	if ordered[0].text() != lines[0].text() {
+		t.Errorf("title moved: %q", ordered[0].text())
+	}
+	if ordered[1].text() != "left first" || ordered[9].text() != "right first" {
+		t.Errorf("columns not read left then right: %q", lineTexts(ordered))
+	}
+
+	// Short pages are left alone
+	if got := pdfReadingOrder(lines[:3], 600); len(got) != 3 {
+		t.Errorf("short page reordered into %d lines", len(got))
+	}
+}
+
+func TestRenderDocumentPages(t *testing.T) {
+	pages := []DocumentPage{
+		{Number: 1, Blocks: []DocumentBlock{
+			{Type: "heading", Level: 2, Text: "Intro"},
+			{Type: "paragraph", Text: "Body."},
+		}},
+		{Number: 2, Error: "broken page"},
+		{Number: 3, Blocks: []DocumentBlock{{Type: "table", Rows: [][]string{{"a"}, {"b"}}}}},
+		{Number: 4},
+	}
+	want := "--- Page 1 ---\n\n## Intro\n\nBody.\n\n--- Page 2 ---\n\n[page 2 could not be read: broken page]\n\n--- Page 3 ---\n\n| a |\n| --- |\n| b |"
+	if got := RenderDocumentPages(pages); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTempFile stores content under name in a temporary directory and
+// returns its path.
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func TestMarkdownTable(t *testing.T) {
+	tests := []struct {
+		name string
+		rows [][]string
+		want string
+	}{
+		{"empty", nil, ""},
+		{"header only", [][]string{{"a", "b"}}, "| a | b |\n| --- | --- |"},
+		{
+			"short rows are padded",
+			[][]string{{"name", "qty", "note"}, {"apple", "3"}},
+			"| name | qty | note |\n| --- | --- | --- |\n| apple | 3 |  |",
+		},
+		{
+			"pipes and whitespace",
+			[][]string{{"expr"}, {"a | b"}, {"  two\n lines "}},
+			"| expr |\n| --- |\n| a \\| b |\n| two lines |",
+		},
+	}
+	for _, tt := range tests {
+		if got := markdownTable(tt.rows); got != tt.want {
+			t.Errorf("%s: markdownTable() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseDocumentRejectsUnsupported(t *testing.T) {
+	if _, err := ParseDocument(writeTempFile(t, "old.doc", "x")); err == nil {
+		t.Error("expected an error for .doc files")
+	}
+	if _, err := ParseDocument(writeTempFile(t, "blob.bin", "x")); err == nil {
+		t.Error("expected an error for unknown extensions")
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// codeLanguages maps source file extensions to the language used for their
+// fenced code block.
+var codeLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".java":  "java",
+	".kt":    "kotlin",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".rs":    "rust",
+	".rb":    "ruby",
+	".php":   "php",
+	".swift": "swift",
+	".scala": "scala",
+	".sh":    "bash",
+	".sql":   "sql",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".xml":   "xml",
+	".css":   "css",
+	".lua":   "lua",
+	".r":     "r",
+}
+
+func readTextFile(filePath string) (string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "\uFFFD")
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n"), nil
+}
+
+// ParseText reads plain text and Markdown as is.
+func ParseText(filePath string) (string, int, error) {
+	text, err := readTextFile(filePath)
+	return strings.TrimSpace(text), 0, err
+}
+
+// ParseSourceCode wraps a source file in a fenced code block so models see
+// where the code starts and ends.
+func ParseSourceCode(filePath string) (string, int, error) {
+	text, err := readTextFile(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	lang := codeLanguages[strings.ToLower(filepath.Ext(filePath))]
+	return fmt.Sprintf("%s%s\n%s\n%s", fence, lang, strings.TrimRight(text, "\n"), fence), 0, nil
+}
+
+// ParseCSV renders a CSV or TSV file as a Markdown table.
+func ParseCSV(filePath string) (string, int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	if strings.EqualFold(filepath.Ext(filePath), ".tsv") {
+		r.Comma = '\t'
+	}
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	var rows [][]string
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		rows = append(rows, record)
+	}
+	return markdownTable(rows), 0, nil
+}
+
+// rtfSkippedDestinations are RTF groups that hold formatting or metadata
+// rather than document text.
+var rtfSkippedDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "header": true, "footer": true, "headerl": true,
+	"headerr": true, "footerl": true, "footerr": true, "listtable": true,
+	"listoverridetable": true, "rsidtbl": true, "generator": true,
+	"themedata": true, "colorschememapping": true, "latentstyles": true,
+	"datastore": true, "xmlnstbl": true, "object": true,
+}
+
+// ParseRTF extracts the text of an RTF document. Table cells are separated
+// with pipes, one row per line.
+func ParseRTF(filePath string) (string, int, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	if !strings.HasPrefix(string(data), "{\\rtf") {
+		return "", 0, fmt.Errorf("not an RTF file")
+	}
+
+	type groupState struct {
+		skip        bool
+		unicodeSkip int
+	}
+
+	var sb strings.Builder
+	stack := []groupState{{unicodeSkip: 1}}
+	pendingSkip := 0 // fallback characters to drop after a \uN escape
+
+	emit := func(s string) {
+		if stack[len(stack)-1].skip {
+			return
+		}
+		if pendingSkip > 0 {
+			pendingSkip--
+			return
+		}
+		sb.WriteString(s)
+	}
+
+	for i := 0; i < len(data); i++ {
+		ch := data[i]
+		switch ch {
+		case '{':
+			stack = append(stack, stack[len(stack)-1])
+		case '}':
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case '\r', '\n':
+		case '\\':
+			if i+1 >= len(data) {
+				break
+			}
+			next := data[i+1]
+			switch {
+			case next == '\\' || next == '{' || next == '}':
+				emit(string(next))
+				i++
+			case next == '*':
+				stack[len(stack)-1].skip = true
+				i++
+			case next == '\'':
+				if i+3 < len(data) {
+					if b, err := strconv.ParseUint(string(data[i+2:i+4]), 16, 8); err == nil {
+						emit(string(rune(b))) // close enough for Windows-1252 text
+					}
+				}
+				i += 3
+			case next == '~':
+				emit(" ")
+				i++
+			case next == '-' || next == '_':
+				i++
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(data) && isASCIILetter(data[j]) {
+					j++
+				}
+				word := string(data[i+1 : j])
+				k := j
+				if k < len(data) && (data[k] == '-' || (data[k] >= '0' && data[k] <= '9')) {
+					k++
+					for k < len(data) && data[k] >= '0' && data[k] <= '9' {
+						k++
+					}
+				}
+				param, hasParam := 0, k > j
+				if hasParam {
+					param, _ = strconv.Atoi(string(data[j:k]))
+				}
+				if k < len(data) && data[k] == ' ' {
+					k++
+				}
+				i = k - 1
+
+				switch word {
+				case "par", "line", "row", "sect", "page":
+					emit("\n")
+				case "tab":
+					emit("\t")
+				case "cell":
+					emit(" | ")
+				case "emdash":
+					emit("—")
+				case "endash":
+					emit("–")
+				case "bullet":
+					emit("•")
+				case "lquote", "rquote":
+					emit("'")
+				case "ldblquote", "rdblquote":
+					emit("\"")
+				case "uc":
+					stack[len(stack)-1].unicodeSkip = param
+				case "u":
+					if param < 0 {
+						param += 65536
+					}
+					emit(string(rune(param)))
+					pendingSkip = stack[len(stack)-1].unicodeSkip
+				default:
+					if rtfSkippedDestinations[word] {
+						stack[len(stack)-1].skip = true
+					}
+				}
+			default:
+				i++
+			}
+		default:
+			emit(string(ch))
+		}
+	}
+
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " |\t")
+	}
+	return collapseBlankLines(strings.Join(lines, "\n")), 0, nil
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+// collapseBlankLines trims text and reduces runs of blank lines to one.
+func collapseBlankLines(text string) string {
+	var out []string
+	blank := false
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if strings.TrimSpace(line) == "" {
+			if !blank {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,94 @@
+package services
+
+import "testing"
+
+func TestParseRTF(t *testing.T) {
+	tests := []struct {
+		name string
+		rtf  string
+		want string
+	}{
+		{
+			"paragraphs and skipped groups",
+			`{\rtf1\ansi{\fonttbl{\f0 Arial;}}{\colortbl;\red0\green0\blue0;}{\*\generator Writer;}\f0 Hello {\b world}\par Second line\par}`,
+			"Hello world\nSecond line",
+		},
+		{
+			"escapes",
+			`{\rtf1 a\{b\}c\\d\~e caf\'e9 \emdash  \ldblquote q\rdblquote}`,
+			"a{b}c\\d e café — \"q\"",
+		},
+		{
+			"unicode with fallback characters",
+			`{\rtf1\uc1 \u8364?5 and {\uc2 \u20320??x}}`,
+			"€5 and 你x",
+		},
+		{
+			"negative unicode",
+			`{\rtf1 \u-3913?}`,
+			"\uf0b7",
+		},
+		{
+			"table rows",
+			`{\rtf1\trowd\cellx1000\cellx2000 A\cell B\cell\row C\cell D\cell\row}`,
+			"A | B\nC | D",
+		},
+		{
+			"blank lines collapse",
+			`{\rtf1 one\par\par\par two}`,
+			"one\n\ntwo",
+		},
+	}
+	for _, tt := range tests {
+		got, _, err := ParseRTF(writeTempFile(t, "doc.rtf", tt.rtf))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, _, err := ParseRTF(writeTempFile(t, "doc.rtf", "plain text")); err == nil {
+		t.Error("expected an error for a file without the RTF header")
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	got, _, err := ParseCSV(writeTempFile(t, "data.csv", "name,qty\n\"Smith, J\",3\nshort\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "| name | qty |\n| --- | --- |\n| Smith, J | 3 |\n| short |  |"
+	if got != want {
+		t.Errorf("csv: got %q, want %q", got, want)
+	}
+
+	got, _, err = ParseCSV(writeTempFile(t, "data.tsv", "a\tb\n1\t2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "| a | b |\n| --- | --- |\n| 1 | 2 |"; got != want {
+		t.Errorf("tsv: got %q, want %q", got, want)
+	}
+}
+
+func TestParseSourceCode(t *testing.T) {
+	got, _, err := ParseSourceCode(writeTempFile(t, "main.go", "\ufeffpackage main\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "```go\npackage main\n```"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Fences inside the file get a longer outer fence
+	got, _, err = ParseSourceCode(writeTempFile(t, "notes.py", "s = '```'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "````python\ns = '```'\n````"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ProviderErrorKind string
+
+const (
+	ErrRateLimit      ProviderErrorKind = "rate_limit"
+	ErrAuth           ProviderErrorKind = "auth"
+	ErrNotFound       ProviderErrorKind = "not_found"
+	ErrQuota          ProviderErrorKind = "quota"
+	ErrTransient      ProviderErrorKind = "transient"
+	ErrInvalidRequest ProviderErrorKind = "invalid_request"
+	ErrUnknown        ProviderErrorKind = "unknown"
+)
+
+// ProviderError is returned by providers for failed API calls so callers can
+// decide whether to retry or fall back without inspecting error strings.
+type ProviderError struct {
+	Provider   string
+	Kind       ProviderErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s API error (%d): %s", e.Provider, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Provider, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the same request may succeed if sent again later.
+func (e *ProviderError) Retryable() bool {
+	return e.Kind == ErrRateLimit || e.Kind == ErrTransient
+}
+
+// AsProviderError extracts a ProviderError from err, if there is one.
+func AsProviderError(err error) (*ProviderError, bool) {
+	var pe *ProviderError
+	if errors.As(err, &pe) {
+		return pe, true
+	}
+	return nil, false
+}
+
+// newHTTPError builds a ProviderError from a non-200 response, consuming its body.
+func newHTTPError(provider string, resp *http.Response) *ProviderError {
+	body, _ := io.ReadAll(resp.Body)
+	message := string(body)
+
+	return &ProviderError{
+		Provider:   provider,
+		Kind:       classifyStatus(resp.StatusCode, message),
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+func newConnectionError(provider string, err error) *ProviderError {
+	return &ProviderError{
+		Provider: provider,
+		Kind:     ErrTransient,
+		Message:  fmt.Sprintf("failed to connect to %s: %v", provider, err),
+		Err:      err,
+	}
+}
+
+func classifyStatus(status int, body string) ProviderErrorKind {
+	bodyLower := strings.ToLower(body)
+
+	switch status {
+	case 401, 403:
+		return ErrAuth
+	case 404:
+		return ErrNotFound
+	case 402:
+		return ErrQuota
+	case 429:
+		// Exhausted quotas also come back as 429 but will not recover by waiting
+		if strings.Contains(bodyLower, "quota") || strings.Contains(bodyLower, "billing") {
+			return ErrQuota
+		}
+		return ErrRateLimit
+	case 408, 500, 502, 503, 504, 529:
+		return ErrTransient
+	case 400:
+		if strings.Contains(bodyLower, "credit balance") {
+			return ErrQuota
+		}
+		if strings.Contains(bodyLower, "not found") || strings.Contains(bodyLower, "does not exist") {
+			return ErrNotFound
+		}
+		return ErrInvalidRequest
+	}
+	return ErrUnknown
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date values.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
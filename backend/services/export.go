@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"localai/database"
+)
+
+const ExportVersion = 1
+
+// SessionExport is the full-fidelity export format. It holds every branch of
+// the conversation and embeds referenced attachments so it can be imported
+// on another machine.
+type SessionExport struct {
+	Version           int                        `json:"version"`
+	ExportedAt        time.Time                  `json:"exported_at"`
+	Name              string                     `json:"name"`
+	ModelConfigs      []database.ModelConfig     `json:"model_configs"`
+	AutonomyRounds    int                        `json:"autonomy_rounds"`
+	TurnTaking        *database.TurnTakingConfig `json:"turn_taking,omitempty"`
+	Workflow          *database.Workflow         `json:"workflow,omitempty"`
+	Debate            *database.DebateConfig     `json:"debate,omitempty"`
+	ParallelResponses bool                       `json:"parallel_responses,omitempty"`
+	Router            *database.RouterConfig     `json:"router,omitempty"`
+	CreatedAt         time.Time                  `json:"created_at"`
+	ActiveLeafID      *string                    `json:"active_leaf_id,omitempty"`
+	Messages          []database.Message         `json:"messages"`
+	Personas          []database.Persona         `json:"personas,omitempty"`
+	Attachments       []ExportedAttachment       `json:"attachments,omitempty"`
+}
+
+type ExportedAttachment struct {
+	ID       string `json:"id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	Data     string `json:"data"`
+}
+
+func BuildSessionExport(s database.Session, configs []database.ModelConfig, messages []database.Message, activeLeaf *string) *SessionExport {
+	exp := &SessionExport{
+		Version:           ExportVersion,
+		ExportedAt:        time.Now(),
+		Name:              s.Name,
+		ModelConfigs:      configs,
+		AutonomyRounds:    s.AutonomyRounds,
+		ParallelResponses: s.ParallelResponses,
+		CreatedAt:         s.CreatedAt,
+		ActiveLeafID:      activeLeaf,
+		Messages:          messages,
+	}
+
+	if s.TurnTaking != "" {
+		turnTaking := database.ParseTurnTaking(s.TurnTaking)
+		exp.TurnTaking = &turnTaking
+	}
+	if workflow := database.ParseWorkflow(s.Workflow); len(workflow.Stages) > 0 {
+		exp.Workflow = &workflow
+	}
+	if debate := database.ParseDebate(s.Debate); debate.Mode != "" {
+		exp.Debate = &debate
+	}
+	if s.Router != "" {
+		router := database.ParseRouter(s.Router)
+		exp.Router = &router
+	}
+
+	personas := make(map[string]bool)
+	for _, c := range configs {
+		if c.PersonaID == "" || personas[c.PersonaID] {
+			continue
+		}
+		personas[c.PersonaID] = true
+		if p, err := database.GetPersona(c.PersonaID); err == nil {
+			exp.Personas = append(exp.Personas, *p)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, m := range messages {
+		for _, id := range m.Attachments {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			a, err := database.GetAttachment(id)
+			if err != nil {
+				continue
+			}
+			data, err := os.ReadFile(a.Path)
+			if err != nil {
+				continue
+			}
+			exp.Attachments = append(exp.Attachments, ExportedAttachment{
+				ID:       a.ID,
+				FileName: a.FileName,
+				MimeType: a.MimeType,
+				Data:     base64.StdEncoding.EncodeToString(data),
+			})
+		}
+	}
+
+	return exp
+}
+
+// RenderMarkdown renders a conversation branch as a readable transcript.
+func RenderMarkdown(name string, configs []database.ModelConfig, branch []database.Message) string {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# %s\n\n", name))
+
+	var models []string
+	for _, c := range configs {
+		models = append(models, fmt.Sprintf("%s (`%s`)", c.Name, c.ModelID))
+	}
+	sb.WriteString(fmt.Sprintf("*Exported %s*", time.Now().Format("2006-01-02 15:04")))
+	if len(models) > 0 {
+		sb.WriteString(" · Models: " + strings.Join(models, ", "))
+	}
+	sb.WriteString("\n")
+
+	for _, m := range branch {
+		speaker := "You"
+		if m.ModelName != nil {
+			speaker = *m.ModelName
+			if m.ModelID != nil {
+				speaker += fmt.Sprintf(" (#%s)", *m.ModelID)
+			}
+		}
+
+		sb.WriteString("\n---\n\n")
+		sb.WriteString(fmt.Sprintf("**%s** · %s\n\n", speaker, m.CreatedAt.Format("2006-01-02 15:04")))
+		sb.WriteString(strings.TrimSpace(m.Content))
+		sb.WriteString("\n")
+		if len(m.Attachments) > 0 {
+			sb.WriteString(fmt.Sprintf("\n*%d attachment(s)*\n", len(m.Attachments)))
+		}
+	}
+
+	return sb.String()
+}
+
+var shareGPTRoles = map[string]string{
+	"system":    "system",
+	"user":      "human",
+	"assistant": "gpt",
+}
+
+// RenderTrainingJSONL writes one training example per model, seen from that
+// model's point of view, in OpenAI chat ("openai") or ShareGPT ("sharegpt")
+// format. Each example ends with the model's last answer.
+func RenderTrainingJSONL(configs []database.ModelConfig, branch []database.Message, style string) ([]byte, error) {
+	if style != "openai" && style != "sharegpt" {
+		return nil, fmt.Errorf("unknown JSONL style: %s", style)
+	}
+
+	o := NewOrchestrator("", configs, 0)
+	o.LoadHistory(branch)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, config := range configs {
+		messages := o.Transcript(config)
+
+		last := -1
+		for i, m := range messages {
+			if m.Role == "assistant" {
+				last = i
+			}
+		}
+		if last < 0 {
+			continue
+		}
+		messages = messages[:last+1]
+
+		var err error
+		if style == "sharegpt" {
+			type turn struct {
+				From  string `json:"from"`
+				Value string `json:"value"`
+			}
+			turns := make([]turn, len(messages))
+			for i, m := range messages {
+				turns[i] = turn{From: shareGPTRoles[m.Role], Value: m.Content}
+			}
+			err = enc.Encode(map[string]interface{}{"conversations": turns})
+		} else {
+			type message struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			}
+			out := make([]message, len(messages))
+			for i, m := range messages {
+				out[i] = message{Role: m.Role, Content: m.Content}
+			}
+			err = enc.Encode(map[string]interface{}{"messages": out})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
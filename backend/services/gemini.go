@@ -81,6 +81,7 @@ func (p *GeminiProvider) ListModels() ([]Model, error) {
 
 type geminiRequest struct {
 	Contents         []geminiContent        `json:"contents"`
+	Tools            []geminiTool           `json:"tools,omitempty"`
 	SystemInstruction *geminiContent        `json:"systemInstruction,omitempty"`
 	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
 }
@@ -91,19 +92,44 @@ type geminiContent struct {
 }
 
 type geminiPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFunctionCall struct {
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []ToolDefinition `json:"functionDeclarations"`
 }
 
 type geminiGenerationConfig struct {
-	MaxOutputTokens int `json:"maxOutputTokens,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	TopK            int      `json:"topK,omitempty"`
+	StopSequences   []string `json:"stopSequences,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
 }
 
 type geminiStreamResponse struct {
 	Candidates []struct {
 		Content struct {
-			Parts []struct {
-				Text string `json:"text"`
-			} `json:"parts"`
+			Parts []geminiPart `json:"parts"`
 		} `json:"content"`
 		FinishReason string `json:"finishReason,omitempty"`
 	} `json:"candidates"`
@@ -114,49 +140,94 @@ type geminiStreamResponse struct {
 	} `json:"usageMetadata,omitempty"`
 }
 
-func (p *GeminiProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string, bool, int)) error {
-	if strings.HasPrefix(model, "gemini:") {
-		model = strings.TrimPrefix(model, "gemini:")
-	}
-
+// toGeminiContents converts chat messages to Gemini contents. Function
+// responses are sent back in a user turn, grouped like the calls they answer.
+func toGeminiContents(messages []ChatMessage) (*geminiContent, []geminiContent) {
 	var contents []geminiContent
 	var systemInstruction *geminiContent
 
 	for _, m := range messages {
-		if m.Role == "system" {
+		switch m.Role {
+		case "system":
 			systemInstruction = &geminiContent{
 				Parts: []geminiPart{{Text: m.Content}},
 			}
-		} else {
+
+		case "tool":
+			part := geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     m.ToolName,
+				Response: map[string]interface{}{"content": m.Content},
+			}}
+			if n := len(contents); n > 0 && contents[n-1].Role == "user" && contents[n-1].Parts[0].FunctionResponse != nil {
+				contents[n-1].Parts = append(contents[n-1].Parts, part)
+			} else {
+				contents = append(contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+			}
+
+		default:
 			role := m.Role
 			if role == "assistant" {
 				role = "model"
 			}
+			var parts []geminiPart
+			for _, part := range m.ContentParts() {
+				switch {
+				case part.Type == "image":
+					parts = append(parts, geminiPart{InlineData: &geminiInlineData{MimeType: part.MimeType, Data: part.Data}})
+				case part.Text != "" || len(m.ToolCalls) == 0:
+					parts = append(parts, geminiPart{Text: part.Text})
+				}
+			}
+			for _, tc := range m.ToolCalls {
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Name, Args: tc.Arguments}})
+			}
 			contents = append(contents, geminiContent{
 				Role:  role,
-				Parts: []geminiPart{{Text: m.Content}},
+				Parts: parts,
 			})
 		}
 	}
 
+	return systemInstruction, contents
+}
+
+func (p *GeminiProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error) {
+	if strings.HasPrefix(model, "gemini:") {
+		model = strings.TrimPrefix(model, "gemini:")
+	}
+	params := opts.Params
+
+	systemInstruction, contents := toGeminiContents(messages)
+
 	reqBody := geminiRequest{
 		Contents:         contents,
 		SystemInstruction: systemInstruction,
 		GenerationConfig: &geminiGenerationConfig{
 			MaxOutputTokens: 4096,
+			Temperature:     params.Temperature,
+			TopP:            params.TopP,
+			TopK:            params.TopK,
+			StopSequences:   params.Stop,
+			Seed:            params.Seed,
 		},
 	}
+	if params.MaxTokens > 0 {
+		reqBody.GenerationConfig.MaxOutputTokens = params.MaxTokens
+	}
+	if len(opts.Tools) > 0 {
+		reqBody.Tools = []geminiTool{{FunctionDeclarations: opts.Tools}}
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:streamGenerateContent?alt=sse&key=%s", model, p.apiKey)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
@@ -164,24 +235,24 @@ func (p *GeminiProvider) StreamChat(ctx context.Context, model string, messages
 	resp, err := client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ctx.Err()
+			return nil, ctx.Err()
 		}
-		return fmt.Errorf("failed to connect to Gemini: %w", err)
+		return nil, newConnectionError("Gemini", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Gemini API error (%d): %s", resp.StatusCode, string(body))
+		return nil, newHTTPError("Gemini", resp)
 	}
 
 	reader := bufio.NewReader(resp.Body)
 	totalTokens := 0
+	var toolCalls []ToolCall
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
@@ -192,9 +263,9 @@ func (p *GeminiProvider) StreamChat(ctx context.Context, model string, messages
 				break
 			}
 			if ctx.Err() != nil {
-				return ctx.Err()
+				return nil, ctx.Err()
 			}
-			return err
+			return nil, err
 		}
 
 		lineStr := strings.TrimSpace(string(line))
@@ -215,18 +286,24 @@ func (p *GeminiProvider) StreamChat(ctx context.Context, model string, messages
 
 		if len(response.Candidates) > 0 {
 			candidate := response.Candidates[0]
-			if len(candidate.Content.Parts) > 0 {
-				text := candidate.Content.Parts[0].Text
-				if text != "" {
-					onChunk(text, false, totalTokens)
+			for _, part := range candidate.Content.Parts {
+				if part.FunctionCall != nil {
+					// Gemini does not assign IDs to function calls
+					toolCalls = append(toolCalls, ToolCall{
+						ID:        fmt.Sprintf("call_%d", len(toolCalls)),
+						Name:      part.FunctionCall.Name,
+						Arguments: part.FunctionCall.Args,
+					})
+				} else if part.Text != "" {
+					onChunk(part.Text, false, totalTokens)
 				}
 			}
 			if candidate.FinishReason == "STOP" {
 				onChunk("", true, totalTokens)
-				return nil
+				return toolCalls, nil
 			}
 		}
 	}
 
-	return nil
+	return toolCalls, nil
 }
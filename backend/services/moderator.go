@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+
+	"localai/database"
+)
+
+// DoneMarker is how participants tell a moderated discussion that the task
+// is finished.
+const DoneMarker = "[DONE]"
+
+// maxModeratorTranscriptChars bounds the transcript sent to a moderator model;
+// the newest part is kept.
+const maxModeratorTranscriptChars = 12000
+
+// SpeakerDecision is the moderator's choice of who speaks next. Next is nil
+// when Done is set.
+type SpeakerDecision struct {
+	Next   *database.ModelConfig
+	Done   bool
+	Reason string
+}
+
+var agreementPhrases = []string{
+	"i agree", "agreed", "nothing to add", "nothing further", "no further",
+	"i have nothing", "+1", "well said", "looks good to me", "lgtm",
+}
+
+// NextSpeaker picks who should speak after the newest message, or ends the
+// discussion. It asks the session's moderator model when one is set and
+// falls back to a heuristic when there is none or its answer is unusable.
+func (o *Orchestrator) NextSpeaker() SpeakerDecision {
+	if len(o.ModelConfigs) == 0 {
+		return SpeakerDecision{Done: true, Reason: "No models in this session"}
+	}
+
+	if o.TurnTaking.ModeratorModel != "" {
+		decision, err := o.askModerator(o.TurnTaking.ModeratorModel)
+		if err == nil {
+			return decision
+		}
+		log.Printf("Moderator %s failed, using heuristic: %v", o.TurnTaking.ModeratorModel, err)
+	}
+	return o.heuristicSpeaker()
+}
+
+// discussionTurns returns the model responses since the last user message.
+func (o *Orchestrator) discussionTurns() []database.Message {
+	start := 0
+	for i := len(o.History) - 1; i >= 0; i-- {
+		if o.History[i].Role == "user" {
+			start = i + 1
+			break
+		}
+	}
+	var turns []database.Message
+	for _, m := range o.History[start:] {
+		if m.ModelID != nil {
+			turns = append(turns, m)
+		}
+	}
+	return turns
+}
+
+// heuristicSpeaker ends the discussion when the last speaker marks the task
+// done or every model only agreed, hands over to a model the last speaker
+// mentioned, and otherwise picks whoever has spoken least, preferring the
+// role the last message calls for.
+func (o *Orchestrator) heuristicSpeaker() SpeakerDecision {
+	turns := o.discussionTurns()
+
+	lastSpeaker := ""
+	lastContent := o.getLastUserMessage()
+	if len(turns) > 0 {
+		last := turns[len(turns)-1]
+		lastSpeaker = *last.ModelID
+		lastContent = StripMentions(last.Content)
+
+		if strings.Contains(last.Content, DoneMarker) {
+			return SpeakerDecision{Done: true, Reason: fmt.Sprintf("%s marked the task as done", *last.ModelName)}
+		}
+
+		latest := make(map[string]string)
+		for _, t := range turns {
+			latest[*t.ModelID] = t.Content
+		}
+		if len(latest) == len(o.ModelConfigs) {
+			allAgree := true
+			for _, content := range latest {
+				if !isAgreement(content) {
+					allAgree = false
+					break
+				}
+			}
+			if allAgree {
+				return SpeakerDecision{Done: true, Reason: "Everyone agrees and nobody has anything to add"}
+			}
+		}
+
+		if mentioned := o.MentionedModels(last.Content, lastSpeaker); len(mentioned) > 0 {
+			return SpeakerDecision{Next: &mentioned[0], Reason: fmt.Sprintf("%s was addressed by %s", mentioned[0].Name, *last.ModelName)}
+		}
+	}
+
+	spoken := make(map[string]int)
+	for _, t := range turns {
+		spoken[*t.ModelID]++
+	}
+	role := ClassifyTask(lastContent)
+
+	var next *database.ModelConfig
+	for i := range o.ModelConfigs {
+		config := &o.ModelConfigs[i]
+		if config.ShortID == lastSpeaker {
+			continue
+		}
+		if next == nil || spoken[config.ShortID] < spoken[next.ShortID] ||
+			(spoken[config.ShortID] == spoken[next.ShortID] && config.Role == role && next.Role != role) {
+			next = config
+		}
+	}
+	if next == nil {
+		return SpeakerDecision{Done: true, Reason: "Nobody else is left to speak"}
+	}
+
+	reason := fmt.Sprintf("%s has spoken least", next.Name)
+	if spoken[next.ShortID] == 0 {
+		reason = fmt.Sprintf("%s has not spoken yet", next.Name)
+	}
+	if next.Role == role && role != database.RoleGeneral {
+		reason += fmt.Sprintf(" and the discussion needs a %s", role)
+	}
+	return SpeakerDecision{Next: next, Reason: reason}
+}
+
+// isAgreement reports whether a response only agrees with others instead of
+// adding something new.
+func isAgreement(content string) bool {
+	text := strings.ToLower(strings.TrimSpace(StripMentions(content)))
+	if text == "" {
+		return true
+	}
+	if utf8.RuneCountInString(text) > 200 {
+		return false
+	}
+	for _, phrase := range agreementPhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// askModerator shows the discussion to a moderator model and parses its
+// decision, which it must give as {"next": "<id>" or "done", "reason": "..."}.
+func (o *Orchestrator) askModerator(moderatorModel string) (SpeakerDecision, error) {
+	var participants strings.Builder
+	for _, c := range o.ModelConfigs {
+		participants.WriteString(fmt.Sprintf("- %s: %s (%s)\n", c.ShortID, c.Name, c.Role))
+	}
+
+	var transcript strings.Builder
+	transcript.WriteString(fmt.Sprintf("User: %s\n\n", o.getLastUserMessage()))
+	for _, m := range o.discussionTurns() {
+		transcript.WriteString(fmt.Sprintf("%s (%s): %s\n\n", *m.ModelName, *m.ModelID, StripMentions(m.Content)))
+	}
+	text := transcript.String()
+	if len(text) > maxModeratorTranscriptChars {
+		cut := len(text) - maxModeratorTranscriptChars
+		for cut < len(text) && !utf8.RuneStart(text[cut]) {
+			cut++
+		}
+		text = text[cut:]
+	}
+
+	system := "You moderate a discussion between AI assistants working on the user's request. " +
+		"Decide who should speak next, or whether the discussion is finished.\n\nParticipants:\n" + participants.String() +
+		"\nChoose \"done\" when the request has been fully handled or the participants only repeat or agree with each other. " +
+		"Reply with JSON only, for example {\"next\": \"<participant id>\", \"reason\": \"<one short sentence>\"} or {\"next\": \"done\", \"reason\": \"...\"}."
+
+	var answer struct {
+		Next   string `json:"next"`
+		Reason string `json:"reason"`
+	}
+	if err := askForJSON(o.Context(), moderatorModel, system, text, &answer); err != nil {
+		return SpeakerDecision{}, err
+	}
+
+	next := strings.TrimPrefix(strings.TrimSpace(answer.Next), "@")
+	if strings.EqualFold(next, "done") {
+		return SpeakerDecision{Done: true, Reason: answer.Reason}, nil
+	}
+	for i := range o.ModelConfigs {
+		config := &o.ModelConfigs[i]
+		if strings.EqualFold(config.ShortID, next) || strings.EqualFold(config.Name, next) {
+			return SpeakerDecision{Next: config, Reason: answer.Reason}, nil
+		}
+	}
+	return SpeakerDecision{}, fmt.Errorf("moderator chose unknown participant %q", answer.Next)
+}
@@ -44,6 +44,9 @@ func (p *OllamaProvider) SupportsModel(modelID string) bool {
 			return false
 		}
 	}
+	if i := strings.Index(modelID, ":"); i > 0 && IsCustomProvider(modelID[:i]) {
+		return false
+	}
 	return true
 }
 
@@ -66,15 +69,67 @@ func (p *OllamaProvider) ListModels() ([]Model, error) {
 	return models, nil
 }
 
-func (p *OllamaProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string, bool, int)) error {
+func (p *OllamaProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error) {
+	params := opts.Params
+
 	ollamaMessages := make([]OllamaChatMessage, len(messages))
 	for i, m := range messages {
 		ollamaMessages[i] = OllamaChatMessage{
-			Role:    m.Role,
-			Content: m.Content,
+			Role:     m.Role,
+			Content:  m.TextContent(),
+			ToolName: m.ToolName,
+		}
+		for _, part := range m.Parts {
+			if part.Type == "image" {
+				ollamaMessages[i].Images = append(ollamaMessages[i].Images, part.Data)
+			}
 		}
+		for _, tc := range m.ToolCalls {
+			ollamaMessages[i].ToolCalls = append(ollamaMessages[i].ToolCalls, OllamaToolCall{
+				Function: OllamaToolCallFunction{Name: tc.Name, Arguments: tc.Arguments},
+			})
+		}
+	}
+
+	var tools []OllamaTool
+	for _, t := range opts.Tools {
+		tools = append(tools, OllamaTool{
+			Type:     "function",
+			Function: t,
+		})
+	}
+
+	options := &OllamaChatOptions{
+		NumPredict:  4096,
+		NumCtx:      DefaultOllamaContext,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		TopK:        params.TopK,
+		Stop:        params.Stop,
+		Seed:        params.Seed,
 	}
-	return StreamChat(ctx, model, ollamaMessages, onChunk)
+	if params.MaxTokens > 0 {
+		options.NumPredict = params.MaxTokens
+	}
+	if params.ContextSize > 0 {
+		options.NumCtx = params.ContextSize
+	}
+
+	ollamaCalls, err := StreamChat(ctx, model, ollamaMessages, tools, options, onChunk)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ollama does not assign IDs to tool calls, so generate stable ones here
+	var toolCalls []ToolCall
+	for i, tc := range ollamaCalls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", i),
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	return toolCalls, nil
 }
 
 type OllamaModel struct {
@@ -89,19 +144,42 @@ type OllamaListResponse struct {
 }
 
 type OllamaChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Images    []string         `json:"images,omitempty"`
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+type OllamaTool struct {
+	Type     string         `json:"type"`
+	Function ToolDefinition `json:"function"`
+}
+
+type OllamaToolCall struct {
+	Function OllamaToolCallFunction `json:"function"`
+}
+
+type OllamaToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
 type OllamaChatOptions struct {
-	NumPredict int `json:"num_predict,omitempty"`
-	NumCtx     int `json:"num_ctx,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	NumCtx      int      `json:"num_ctx,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        int      `json:"top_k,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
 }
 
 type OllamaChatRequest struct {
 	Model    string              `json:"model"`
 	Messages []OllamaChatMessage `json:"messages"`
 	Stream   bool                `json:"stream"`
+	Tools    []OllamaTool        `json:"tools,omitempty"`
 	Options  *OllamaChatOptions  `json:"options,omitempty"`
 }
 
@@ -310,25 +388,23 @@ func CreateModelFromGGUF(modelName, ggufPath string) error {
 	return nil
 }
 
-func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage, onChunk func(string, bool, int)) error {
+func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage, tools []OllamaTool, options *OllamaChatOptions, onChunk func(string, bool, int)) ([]OllamaToolCall, error) {
 	reqBody := OllamaChatRequest{
 		Model:    model,
 		Messages: messages,
 		Stream:   true,
-		Options: &OllamaChatOptions{
-			NumPredict: 4096,
-			NumCtx:     8192,
-		},
+		Tools:    tools,
+		Options:  options,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", ollamaURL+"/api/chat", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
@@ -336,19 +412,24 @@ func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage,
 	resp, err := client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ctx.Err()
+			return nil, ctx.Err()
 		}
-		return fmt.Errorf("failed to connect to Ollama: %w", err)
+		return nil, newConnectionError("Ollama", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		return nil, newHTTPError("Ollama", resp)
+	}
+
 	reader := bufio.NewReader(resp.Body)
 	totalTokens := 0
+	var toolCalls []OllamaToolCall
 
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
@@ -358,9 +439,9 @@ func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage,
 				break
 			}
 			if ctx.Err() != nil {
-				return ctx.Err()
+				return nil, ctx.Err()
 			}
-			return err
+			return nil, err
 		}
 
 		var chunk OllamaChatResponse
@@ -372,6 +453,8 @@ func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage,
 			totalTokens = chunk.EvalCount
 		}
 
+		toolCalls = append(toolCalls, chunk.Message.ToolCalls...)
+
 		onChunk(chunk.Message.Content, chunk.Done, totalTokens)
 
 		if chunk.Done {
@@ -379,5 +462,5 @@ func StreamChat(ctx context.Context, model string, messages []OllamaChatMessage,
 		}
 	}
 
-	return nil
+	return toolCalls, nil
 }
@@ -7,21 +7,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
+
+	"localai/database"
 )
 
 type OpenAIProvider struct {
-	name    string
-	baseURL string
-	apiKey  string
-	models  []string
+	name     string
+	baseURL  string
+	apiKey   string
+	headers  map[string]string
+	discover bool
+	models   []string
+	mu       sync.RWMutex
+
+	discoverOnce sync.Once
+}
+
+type OpenAIProviderConfig struct {
+	BaseURL  string
+	Models   []string
+	Headers  map[string]string
+	Discover bool
 }
 
-var OpenAIProviderConfigs = map[string]struct {
-	BaseURL string
-	Models  []string
-}{
+var OpenAIProviderConfigs = map[string]OpenAIProviderConfig{
 	"openai": {
 		BaseURL: "https://api.openai.com/v1",
 		Models:  []string{"gpt-4o", "gpt-4o-mini", "gpt-4-turbo", "gpt-4", "gpt-3.5-turbo"},
@@ -53,13 +67,57 @@ func NewOpenAIProvider(name, baseURL, apiKey string, models []string) *OpenAIPro
 	}
 }
 
+var (
+	customProviderConfigs = make(map[string]OpenAIProviderConfig)
+	customProviderMu      sync.RWMutex
+)
+
+func SetCustomProviderConfig(cp database.CustomProvider) {
+	customProviderMu.Lock()
+	defer customProviderMu.Unlock()
+	customProviderConfigs[cp.Name] = OpenAIProviderConfig{
+		BaseURL:  strings.TrimRight(cp.BaseURL, "/"),
+		Models:   cp.Models,
+		Headers:  cp.Headers,
+		Discover: cp.AutoDiscover,
+	}
+}
+
+func RemoveCustomProviderConfig(name string) {
+	customProviderMu.Lock()
+	defer customProviderMu.Unlock()
+	delete(customProviderConfigs, name)
+}
+
+func IsCustomProvider(name string) bool {
+	customProviderMu.RLock()
+	defer customProviderMu.RUnlock()
+	_, ok := customProviderConfigs[name]
+	return ok
+}
+
+func getOpenAIProviderConfig(name string) (OpenAIProviderConfig, bool) {
+	if config, ok := OpenAIProviderConfigs[name]; ok {
+		return config, true
+	}
+	customProviderMu.RLock()
+	defer customProviderMu.RUnlock()
+	config, ok := customProviderConfigs[name]
+	return config, ok
+}
+
 func RegisterOpenAIProvider(name, apiKey string) {
-	config, ok := OpenAIProviderConfigs[name]
+	config, ok := getOpenAIProviderConfig(name)
 	if !ok {
 		return
 	}
 	provider := NewOpenAIProvider(name, config.BaseURL, apiKey, config.Models)
+	provider.headers = config.Headers
+	provider.discover = config.Discover
 	Providers.Register(provider)
+	if provider.discover {
+		go provider.ensureDiscovered()
+	}
 }
 
 func ValidateOpenAIKey(name, apiKey string) error {
@@ -105,7 +163,12 @@ func (p *OpenAIProvider) SupportsModel(modelID string) bool {
 	if strings.HasPrefix(modelID, prefix) {
 		return true
 	}
+	if p.discover {
+		p.ensureDiscovered()
+	}
 
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	for _, m := range p.models {
 		if m == modelID {
 			return true
@@ -114,7 +177,87 @@ func (p *OpenAIProvider) SupportsModel(modelID string) bool {
 	return false
 }
 
+func (p *OpenAIProvider) setHeaders(req *http.Request) {
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	for k, v := range p.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// discoverModels asks the server's /models endpoint which models it serves.
+func (p *OpenAIProvider) discoverModels() ([]string, error) {
+	req, err := http.NewRequest("GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+	p.setHeaders(req)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", p.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s API error (%d): %s", p.name, resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	models := make([]string, 0, len(result.Data))
+	for _, m := range result.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// refreshModels replaces the model list with the discovered one. The old
+// list is kept when discovery fails.
+func (p *OpenAIProvider) refreshModels() error {
+	discovered, err := p.discoverModels()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.models = discovered
+	return nil
+}
+
+// ensureDiscovered discovers the models the first time it is called, so bare
+// model IDs resolve before anyone has listed the provider's models.
+func (p *OpenAIProvider) ensureDiscovered() {
+	p.discoverOnce.Do(func() {
+		if err := p.refreshModels(); err != nil {
+			log.Printf("Model discovery for %s failed: %v", p.name, err)
+		}
+	})
+}
+
 func (p *OpenAIProvider) ListModels() ([]Model, error) {
+	if p.discover {
+		err := p.refreshModels()
+		p.mu.RLock()
+		known := len(p.models)
+		p.mu.RUnlock()
+		if err != nil && known == 0 {
+			return nil, err
+		}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	models := make([]Model, len(p.models))
 	for i, m := range p.models {
 		models[i] = Model{
@@ -127,14 +270,74 @@ func (p *OpenAIProvider) ListModels() ([]Model, error) {
 }
 
 type openAIChatRequest struct {
-	Model    string              `json:"model"`
-	Messages []openAIChatMessage `json:"messages"`
-	Stream   bool                `json:"stream"`
+	Model       string              `json:"model"`
+	Messages    []openAIChatMessage `json:"messages"`
+	Stream      bool                `json:"stream"`
+	Temperature *float64            `json:"temperature,omitempty"`
+	TopP        *float64            `json:"top_p,omitempty"`
+	TopK        int                 `json:"top_k,omitempty"`
+	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Stop        []string            `json:"stop,omitempty"`
+	Seed        *int                `json:"seed,omitempty"`
+	Tools       []openAITool        `json:"tools,omitempty"`
 }
 
 type openAIChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url,omitempty"`
+}
+
+// openAIContent returns a plain string for text-only messages and the
+// content-part array form when images are attached.
+func openAIContent(m ChatMessage) interface{} {
+	if !m.HasImages() {
+		return m.TextContent()
+	}
+	var parts []openAIContentPart
+	for _, p := range m.Parts {
+		switch p.Type {
+		case "text":
+			parts = append(parts, openAIContentPart{Type: "text", Text: p.Text})
+		case "image":
+			part := openAIContentPart{Type: "image_url"}
+			part.ImageURL = &struct {
+				URL string `json:"url"`
+			}{URL: "data:" + p.MimeType + ";base64," + p.Data}
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function ToolDefinition `json:"function"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAIToolCallDelta is a streamed fragment of a tool call. Index says which
+// call it extends; requests echo tool calls back without one.
+type openAIToolCallDelta struct {
+	Index int `json:"index"`
+	openAIToolCall
 }
 
 type openAIStreamChunk struct {
@@ -142,7 +345,8 @@ type openAIStreamChunk struct {
 	Object  string `json:"object"`
 	Choices []struct {
 		Delta struct {
-			Content string `json:"content"`
+			Content   string                `json:"content"`
+			ToolCalls []openAIToolCallDelta `json:"tool_calls"`
 		} `json:"delta"`
 		FinishReason *string `json:"finish_reason"`
 	} `json:"choices"`
@@ -151,60 +355,82 @@ type openAIStreamChunk struct {
 	} `json:"usage"`
 }
 
-func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string, bool, int)) error {
+func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error) {
 	prefix := p.name + ":"
 	if strings.HasPrefix(model, prefix) {
 		model = strings.TrimPrefix(model, prefix)
 	}
+	params := opts.Params
 
 	openAIMessages := make([]openAIChatMessage, len(messages))
 	for i, m := range messages {
 		openAIMessages[i] = openAIChatMessage{
-			Role:    m.Role,
-			Content: m.Content,
+			Role:       m.Role,
+			Content:    openAIContent(m),
+			ToolCallID: m.ToolCallID,
+		}
+		for _, tc := range m.ToolCalls {
+			call := openAIToolCall{ID: tc.ID, Type: "function"}
+			call.Function.Name = tc.Name
+			call.Function.Arguments = string(tc.Arguments)
+			openAIMessages[i].ToolCalls = append(openAIMessages[i].ToolCalls, call)
 		}
 	}
 
 	reqBody := openAIChatRequest{
-		Model:    model,
-		Messages: openAIMessages,
-		Stream:   true,
+		Model:       model,
+		Messages:    openAIMessages,
+		Stream:      true,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		MaxTokens:   params.MaxTokens,
+		Stop:        params.Stop,
+		Seed:        params.Seed,
+	}
+	// top_k is not part of the OpenAI schema; only self-hosted servers accept it
+	if IsCustomProvider(p.name) {
+		reqBody.TopK = params.TopK
+	}
+	for _, t := range opts.Tools {
+		reqBody.Tools = append(reqBody.Tools, openAITool{Type: "function", Function: t})
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/chat/completions", bytes.NewBuffer(jsonBody))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	p.setHeaders(req)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		if ctx.Err() != nil {
-			return ctx.Err()
+			return nil, ctx.Err()
 		}
-		return fmt.Errorf("failed to connect to %s: %w", p.name, err)
+		return nil, newConnectionError(p.name, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("%s API error (%d): %s", p.name, resp.StatusCode, string(body))
+		return nil, newHTTPError(p.name, resp)
 	}
 
 	reader := bufio.NewReader(resp.Body)
 	totalTokens := 0
 
+	// Tool call fragments arrive spread over many chunks, keyed by index
+	var pendingCalls []*openAIToolCall
+
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return nil, ctx.Err()
 		default:
 		}
 
@@ -214,9 +440,9 @@ func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages
 				break
 			}
 			if ctx.Err() != nil {
-				return ctx.Err()
+				return nil, ctx.Err()
 			}
-			return err
+			return nil, err
 		}
 
 		lineStr := strings.TrimSpace(string(line))
@@ -243,6 +469,22 @@ func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages
 			content := chunk.Choices[0].Delta.Content
 			done := chunk.Choices[0].FinishReason != nil
 
+			for _, tc := range chunk.Choices[0].Delta.ToolCalls {
+				for len(pendingCalls) <= tc.Index {
+					pendingCalls = append(pendingCalls, nil)
+				}
+				pc := pendingCalls[tc.Index]
+				if pc == nil {
+					pc = &openAIToolCall{}
+					pendingCalls[tc.Index] = pc
+				}
+				if tc.ID != "" {
+					pc.ID = tc.ID
+				}
+				pc.Function.Name += tc.Function.Name
+				pc.Function.Arguments += tc.Function.Arguments
+			}
+
 			if chunk.Usage != nil {
 				totalTokens = chunk.Usage.TotalTokens
 			}
@@ -257,5 +499,24 @@ func (p *OpenAIProvider) StreamChat(ctx context.Context, model string, messages
 		}
 	}
 
-	return nil
+	return collectOpenAIToolCalls(pendingCalls), nil
+}
+
+func collectOpenAIToolCalls(pending []*openAIToolCall) []ToolCall {
+	var toolCalls []ToolCall
+	for i, pc := range pending {
+		if pc == nil {
+			continue
+		}
+		id := pc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+		args := json.RawMessage(pc.Function.Arguments)
+		if !json.Valid(args) {
+			args, _ = json.Marshal(pc.Function.Arguments)
+		}
+		toolCalls = append(toolCalls, ToolCall{ID: id, Name: pc.Function.Name, Arguments: args})
+	}
+	return toolCalls
 }
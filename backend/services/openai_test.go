@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestOpenAIProviderDiscoversModelsOnFirstLookup(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"data":[{"id":"remote-model"}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider("gateway", srv.URL, "", nil)
+	p.discover = true
+
+	if !p.SupportsModel("remote-model") {
+		t.Error("bare ID of a discovered model is not supported")
+	}
+	if p.SupportsModel("other-model") {
+		t.Error("unknown model reported as supported")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("discovery ran %d times, want once", n)
+	}
+}
+
+func TestOpenAIProviderToolCalls(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"lookup","arguments":"{\"q\":"}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"x\"}"}}]}}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+`))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAIProvider("gateway", srv.URL, "", nil)
+	messages := []ChatMessage{
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_0", Name: "lookup", Arguments: json.RawMessage(`{}`)}}},
+		{Role: "tool", ToolCallID: "call_0", Content: "result"},
+	}
+	calls, err := p.StreamChat(context.Background(), "m", messages, ChatOptions{}, func(string, bool, int) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(body), `"index"`) {
+		t.Errorf("request tool calls carry a streaming index: %s", body)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_a" || string(calls[0].Arguments) != `{"q":"x"}` {
+		t.Errorf("tool calls = %+v, want one assembled call", calls)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
 	"sync"
@@ -12,42 +13,87 @@ import (
 )
 
 type Orchestrator struct {
-	SessionID      string
-	ModelConfigs   []database.ModelConfig
-	AutonomyRounds int
-	History        []database.Message
-	mu             sync.Mutex
-	stopRequested  bool
-	pauseRequested bool
-	ctx            context.Context
-	cancel         context.CancelFunc
+	SessionID         string
+	SessionName       string
+	ModelConfigs      []database.ModelConfig
+	AutonomyRounds    int
+	TurnTaking        database.TurnTakingConfig
+	Workflow          database.Workflow
+	Debate            database.DebateConfig
+	ParallelResponses bool
+	Router            database.RouterConfig
+	History           []database.Message
+	mu                sync.Mutex
+	stopRequested     bool
+	pauseRequested    bool
+	blindKinds        []string
+	running           int
+	pendingConfig     *SessionConfig
+	idle              *sync.Cond
+	ctx               context.Context
+	cancel            context.CancelFunc
+	summaries         map[string]historySummary
+	summaryMu         sync.Mutex
+	retrieval         *cachedRetrieval
+}
+
+// historySummary is a cached summary of the first covered history messages
+// dropped during compaction.
+type historySummary struct {
+	text    string
+	covered int
+}
+
+// SessionConfig holds the session settings an orchestrator runs with.
+type SessionConfig struct {
+	Name              string
+	ModelConfigs      []database.ModelConfig
+	AutonomyRounds    int
+	TurnTaking        database.TurnTakingConfig
+	Workflow          database.Workflow
+	Debate            database.DebateConfig
+	ParallelResponses bool
+	Router            database.RouterConfig
 }
 
 type StreamMessage struct {
-	Type            string  `json:"type"`
-	ModelID         string  `json:"model_id,omitempty"`
-	ModelName       string  `json:"model_name,omitempty"`
-	Content         string  `json:"content,omitempty"`
-	Tokens          int     `json:"tokens,omitempty"`
-	TokensPerSecond float64 `json:"tokens_per_second,omitempty"`
-	Round           int     `json:"round,omitempty"`
-	Error           string  `json:"error,omitempty"`
-	Color           string  `json:"color,omitempty"`
+	Type            string                    `json:"type"`
+	ModelID         string                    `json:"model_id,omitempty"`
+	ModelName       string                    `json:"model_name,omitempty"`
+	Content         string                    `json:"content,omitempty"`
+	Tokens          int                       `json:"tokens,omitempty"`
+	TokensPerSecond float64                   `json:"tokens_per_second,omitempty"`
+	Round           int                       `json:"round,omitempty"`
+	Error           string                    `json:"error,omitempty"`
+	Color           string                    `json:"color,omitempty"`
+	ToolCallID      string                    `json:"tool_call_id,omitempty"`
+	ToolName        string                    `json:"tool_name,omitempty"`
+	ToolArgs        string                    `json:"tool_args,omitempty"`
+	Stage           string                    `json:"stage,omitempty"`
+	Kind            string                    `json:"kind,omitempty"`
+	Routing         *database.RoutingDecision `json:"routing,omitempty"`
 }
 
 func NewOrchestrator(sessionID string, configs []database.ModelConfig, rounds int) *Orchestrator {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Orchestrator{
+	o := &Orchestrator{
 		SessionID:      sessionID,
 		ModelConfigs:   configs,
 		AutonomyRounds: rounds,
+		TurnTaking:     database.TurnTakingConfig{Mode: database.TurnTakingRoundRobin},
+		Router:         database.RouterConfig{Mode: database.RouterKeyword},
 		History:        make([]database.Message, 0),
+		summaries:      make(map[string]historySummary),
 		ctx:            ctx,
 		cancel:         cancel,
 	}
+	o.idle = sync.NewCond(&o.mu)
+	return o
 }
 
 func (o *Orchestrator) Context() context.Context {
+	o.mu.Lock()
+	defer o.mu.Unlock()
 	return o.ctx
 }
 
@@ -58,12 +104,75 @@ func (o *Orchestrator) Stop() {
 	o.cancel()
 }
 
-func (o *Orchestrator) Reset() {
+// Begin marks the start of a generation, clearing any earlier stop or pause
+// in the same locked step so a concurrent Stop is never lost. A cancelled
+// context is replaced; generations already running keep sharing a live one.
+// The returned function marks its end and must be called exactly once.
+func (o *Orchestrator) Begin() func() {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 	o.stopRequested = false
 	o.pauseRequested = false
+	if o.ctx.Err() != nil {
+		o.ctx, o.cancel = context.WithCancel(context.Background())
+	}
+	o.running++
+	return o.end
+}
+
+func (o *Orchestrator) end() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.running--
+	if o.running == 0 {
+		if o.pendingConfig != nil {
+			o.applyConfig(*o.pendingConfig)
+			o.pendingConfig = nil
+		}
+		o.idle.Broadcast()
+	}
+}
+
+// UpdateConfig replaces the session settings. Generations read them without
+// locking, so while one is running the update is held back and applied when
+// the last one ends.
+func (o *Orchestrator) UpdateConfig(c SessionConfig) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.running > 0 {
+		o.pendingConfig = &c
+		return
+	}
+	o.applyConfig(c)
+}
+
+func (o *Orchestrator) applyConfig(c SessionConfig) {
+	o.SessionName = c.Name
+	o.ModelConfigs = c.ModelConfigs
+	o.AutonomyRounds = c.AutonomyRounds
+	o.TurnTaking = c.TurnTaking
+	o.Workflow = c.Workflow
+	o.Debate = c.Debate
+	o.ParallelResponses = c.ParallelResponses
+	o.Router = c.Router
+}
+
+// Interrupt stops any generation in progress and waits for it to finish,
+// so its response is saved before the history is changed. It then resets
+// the orchestrator and begins a new generation like Begin.
+func (o *Orchestrator) Interrupt() func() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stopRequested = true
+	o.cancel()
+	for o.running > 0 {
+		o.idle.Wait()
+	}
+	o.stopRequested = false
+	o.pauseRequested = false
 	o.ctx, o.cancel = context.WithCancel(context.Background())
+	o.running++
+	return o.end
 }
 
 func (o *Orchestrator) Pause() {
@@ -90,6 +199,15 @@ func (o *Orchestrator) IsPaused() bool {
 	return o.pauseRequested
 }
 
+// SetBlind hides other models' messages of the given kinds on the current
+// question, so each model decides without seeing the others. Calling it
+// without kinds shows everything again.
+func (o *Orchestrator) SetBlind(kinds ...string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.blindKinds = kinds
+}
+
 func StripMentions(content string) string {
 	re := regexp.MustCompile(`@\[[^\]]+\]\s*`)
 	return strings.TrimSpace(re.ReplaceAllString(content, ""))
@@ -131,72 +249,42 @@ func ExtractMentionsFromUserMessage(content string, configs []database.ModelConf
 	return unique
 }
 
-func ClassifyTask(content string) string {
-	contentLower := strings.ToLower(content)
-
-	planningKeywords := []string{
-		"plan", "planning", "brainstorm", "ideas", "think about",
-		"design", "architect", "strategy", "approach", "outline",
-		"what should", "how should", "let's discuss", "think through",
-		"consider", "propose", "suggest", "recommendation",
-	}
-
-	codingKeywords := []string{
-		"code", "coding", "implement", "write", "build", "create",
-		"function", "class", "method", "api", "endpoint", "database",
-		"fix bug", "debug", "refactor", "program", "script", "develop",
-		"html", "css", "javascript", "python", "go", "swift", "react",
-	}
-
-	reviewKeywords := []string{
-		"review", "check", "analyze", "evaluate", "assess",
-		"feedback", "improve", "optimize", "critique", "look at",
-		"what's wrong", "find issues", "bugs in",
-	}
-
-	planningScore := 0
-	codingScore := 0
-	reviewScore := 0
-
-	for _, kw := range planningKeywords {
-		if strings.Contains(contentLower, kw) {
-			planningScore++
-		}
-	}
+var codeSpanPattern = regexp.MustCompile("(?s)```.*?```|`[^`\n]*`")
 
-	for _, kw := range codingKeywords {
-		if strings.Contains(contentLower, kw) {
-			codingScore++
-		}
-	}
+// MentionedModels returns the other models an assistant response hands over
+// to with @mentions. Code is ignored so decorators and annotations do not
+// count, and @all is not honoured to keep one response from waking everyone.
+func (o *Orchestrator) MentionedModels(content, speaker string) []database.ModelConfig {
+	text := codeSpanPattern.ReplaceAllString(content, "")
 
-	for _, kw := range reviewKeywords {
-		if strings.Contains(contentLower, kw) {
-			reviewScore++
+	seen := make(map[string]bool)
+	var mentioned []database.ModelConfig
+	for _, m := range ExtractMentionsFromUserMessage(text, o.ModelConfigs) {
+		for _, config := range o.ModelConfigs {
+			if config.ShortID == speaker || seen[config.ShortID] {
+				continue
+			}
+			if strings.EqualFold(config.ShortID, m) || strings.EqualFold(config.Name, m) {
+				seen[config.ShortID] = true
+				mentioned = append(mentioned, config)
+				break
+			}
 		}
 	}
-
-	if planningScore > codingScore && planningScore > reviewScore && planningScore > 0 {
-		return database.RolePlanner
-	}
-	if codingScore > planningScore && codingScore > reviewScore && codingScore > 0 {
-		return database.RoleCoder
-	}
-	if reviewScore > planningScore && reviewScore > codingScore && reviewScore > 0 {
-		return database.RoleReviewer
-	}
-
-	return database.RoleGeneral
+	return mentioned
 }
 
-func (o *Orchestrator) GetRespondingModels(mentionedModels []string, userMessage string) []database.ModelConfig {
+// GetRespondingModels returns the models that answer a user message: the
+// ones mentioned, or else the ones the session's router picks. The routing
+// decision is nil when mentions decided.
+func (o *Orchestrator) GetRespondingModels(mentionedModels []string, userMessage string) ([]database.ModelConfig, *database.RoutingDecision) {
 	if len(o.ModelConfigs) == 0 {
-		return o.ModelConfigs
+		return o.ModelConfigs, nil
 	}
 
 	for _, mentioned := range mentionedModels {
 		if strings.EqualFold(mentioned, "all") {
-			return o.ModelConfigs
+			return o.ModelConfigs, nil
 		}
 	}
 
@@ -211,25 +299,23 @@ func (o *Orchestrator) GetRespondingModels(mentionedModels []string, userMessage
 			}
 		}
 		if len(responding) > 0 {
-			return responding
+			return responding, nil
 		}
 	}
 
-	taskRole := ClassifyTask(userMessage)
-
-	for _, config := range o.ModelConfigs {
-		if config.Role == taskRole {
-			return []database.ModelConfig{config}
-		}
+	decision, err := NewTaskRouter(o.Router).Route(o.Context(), StripMentions(userMessage), o.ModelConfigs)
+	if err != nil {
+		log.Printf("Routing failed, answering with %s: %v", o.ModelConfigs[0].Name, err)
+		return []database.ModelConfig{o.ModelConfigs[0]}, nil
 	}
 
+	var responding []database.ModelConfig
 	for _, config := range o.ModelConfigs {
-		if config.Role == database.RoleGeneral {
-			return []database.ModelConfig{config}
+		if containsString(decision.Responders, config.ShortID) {
+			responding = append(responding, config)
 		}
 	}
-
-	return []database.ModelConfig{o.ModelConfigs[0]}
+	return responding, &decision
 }
 
 func (o *Orchestrator) BuildSystemPrompt(forModel database.ModelConfig) string {
@@ -239,16 +325,32 @@ func (o *Orchestrator) BuildSystemPrompt(forModel database.ModelConfig) string {
 
 	if forModel.SystemPrompt != "" {
 		sb.WriteString(" ")
-		sb.WriteString(forModel.SystemPrompt)
+		sb.WriteString(o.renderPrompt(forModel.SystemPrompt, forModel))
+	} else if role, ok := LookupRole(forModel.Role); ok && role.SystemPrompt != "" {
+		sb.WriteString(" ")
+		sb.WriteString(o.renderPrompt(role.SystemPrompt, forModel))
 	}
 
 	sb.WriteString("\n\nRules:\n")
 	sb.WriteString("- Only discuss what the user actually said. Do not invent or assume topics.\n")
 	sb.WriteString("- Do not pretend to have had previous conversations that didn't happen.\n")
-	sb.WriteString("- Do not claim capabilities you don't have (like browsing the web, generating images, or executing code).\n")
-	sb.WriteString("- You are a text-based assistant. You can only provide text responses.\n")
+	tools := Tools.Definitions(forModel.Tools)
+	if len(tools) == 0 {
+		sb.WriteString("- Do not claim capabilities you don't have (like browsing the web, generating images, or executing code).\n")
+		sb.WriteString("- You are a text-based assistant. You can only provide text responses.\n")
+	} else {
+		sb.WriteString("- Do not claim capabilities beyond the tools listed below.\n")
+	}
 	sb.WriteString("- If you don't know something, say so.\n")
 
+	if len(tools) > 0 {
+		sb.WriteString("\n## Tools\n")
+		sb.WriteString("You can call these tools when they help you answer. Only use them when needed and never invent tool results:\n")
+		for _, t := range tools {
+			sb.WriteString(fmt.Sprintf("- %s: %s\n", t.Name, t.Description))
+		}
+	}
+
 	if len(o.ModelConfigs) > 1 {
 		sb.WriteString("\n## Multi-Agent Collaboration\n")
 		sb.WriteString("You are in a multi-agent chat with other AI assistants. ")
@@ -260,6 +362,16 @@ func (o *Orchestrator) BuildSystemPrompt(forModel database.ModelConfig) string {
 		sb.WriteString("- For simple greetings/questions, ONE brief response is enough - don't keep chatting about being ready to help.\n")
 		sb.WriteString("- Focus on the actual task. If there's no task yet, wait for one instead of making small talk.\n")
 		sb.WriteString("- If another assistant has already answered well, say 'I agree with [name]' or stay silent rather than repeating.\n")
+		var others []string
+		for _, c := range o.ModelConfigs {
+			if c.ShortID != forModel.ShortID {
+				others = append(others, fmt.Sprintf("%s (@%s)", c.Name, c.ShortID))
+			}
+		}
+		sb.WriteString(fmt.Sprintf("- To hand work to another assistant, mention them by their @id; they answer next. Other assistants: %s.\n", strings.Join(others, ", ")))
+		if o.TurnTaking.Mode == database.TurnTakingModerator {
+			sb.WriteString(fmt.Sprintf("- A moderator picks who speaks next. When the task is finished, end your message with %s.\n", DoneMarker))
+		}
 	}
 
 	sb.WriteString("\nUse markdown code blocks with language tags when sharing code.")
@@ -268,43 +380,124 @@ func (o *Orchestrator) BuildSystemPrompt(forModel database.ModelConfig) string {
 }
 
 func (o *Orchestrator) BuildChatMessages(forModel database.ModelConfig, currentPrompt string) []ChatMessage {
-	var messages []ChatMessage
+	system := ChatMessage{
+		Role:    "system",
+		Content: o.BuildSystemPrompt(forModel),
+	}
+
+	query := currentPrompt
+	if query == "" {
+		query = o.getLastUserMessage()
+	}
+	system.Content += o.retrievalContext(query)
 
-	systemPrompt := o.BuildSystemPrompt(forModel)
-	messages = append(messages, ChatMessage{
+	entries := o.historyEntries(forModel, true)
+
+	var extra []ChatMessage
+	if currentPrompt != "" && currentPrompt != o.getLastUserMessage() {
+		extra = append(extra, ChatMessage{
+			Role:    "user",
+			Content: currentPrompt,
+		})
+	}
+
+	return o.fitToContext(forModel, system, entries, extra)
+}
+
+// Transcript returns the whole history as forModel sees it, without images
+// or compaction. It is used for exports.
+func (o *Orchestrator) Transcript(forModel database.ModelConfig) []ChatMessage {
+	system := ChatMessage{
 		Role:    "system",
-		Content: systemPrompt,
-	})
+		Content: o.BuildSystemPrompt(forModel),
+	}
+	return assembleMessages(system, o.historyEntries(forModel, false), nil)
+}
+
+// historyEntries converts the history to chat messages from forModel's point
+// of view: its own turns are assistant messages and other models' turns are
+// attributed user messages.
+func (o *Orchestrator) historyEntries(forModel database.ModelConfig, withImages bool) []historyEntry {
+	o.mu.Lock()
+	blindKinds := o.blindKinds
+	o.mu.Unlock()
+	hidden := func(kind string) bool {
+		for _, k := range blindKinds {
+			if k == kind {
+				return true
+			}
+		}
+		return false
+	}
 
-	for _, msg := range o.History {
+	lastUser := -1
+	for i, msg := range o.History {
+		if msg.Role == "user" {
+			lastUser = i
+		}
+	}
+
+	var entries []historyEntry
+	for i, msg := range o.History {
+		if i > lastUser && hidden(msg.Kind) && (msg.ModelID == nil || *msg.ModelID != forModel.ShortID) {
+			continue
+		}
 		cleanContent := StripMentions(msg.Content)
 
+		var message ChatMessage
 		if msg.Role == "user" {
-			messages = append(messages, ChatMessage{
+			content := cleanContent + documentAttachmentText(msg.Attachments)
+			message = ChatMessage{
 				Role:    "user",
-				Content: cleanContent,
-			})
+				Content: content,
+			}
+			if withImages {
+				message.Parts = buildUserParts(content, msg.Attachments)
+			}
 		} else if msg.ModelID != nil && *msg.ModelID == forModel.ShortID {
-			messages = append(messages, ChatMessage{
+			message = ChatMessage{
 				Role:    "assistant",
 				Content: cleanContent,
-			})
+			}
 		} else if msg.ModelName != nil {
-			messages = append(messages, ChatMessage{
+			message = ChatMessage{
 				Role:    "user",
 				Content: fmt.Sprintf("[%s (#%s)]: %s", *msg.ModelName, *msg.ModelID, cleanContent),
-			})
+			}
+		} else {
+			continue
 		}
-	}
 
-	if currentPrompt != "" && currentPrompt != o.getLastUserMessage() {
-		messages = append(messages, ChatMessage{
-			Role:    "user",
-			Content: currentPrompt,
+		entries = append(entries, historyEntry{
+			index:   i,
+			message: message,
+			tokens:  EstimateMessageTokens(message),
+			pinned:  msg.Pinned,
 		})
 	}
+	return entries
+}
 
-	return messages
+// buildUserParts attaches image attachments to a user message. It returns nil
+// for messages without images so they keep the plain Content form; document
+// attachments are already inlined into the content.
+func buildUserParts(content string, attachmentIDs []string) []ContentPart {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+
+	parts := []ContentPart{{Type: "text", Text: content}}
+	for _, id := range attachmentIDs {
+		part, err := LoadImagePart(id)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 1 {
+		return nil
+	}
+	return parts
 }
 
 func (o *Orchestrator) getLastUserMessage() string {
@@ -328,6 +521,44 @@ func (o *Orchestrator) LoadHistory(messages []database.Message) {
 	o.History = messages
 }
 
+// LastMessageID returns the ID of the newest history message, which new
+// messages use as their parent.
+func (o *Orchestrator) LastMessageID() *string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.History) == 0 {
+		return nil
+	}
+	id := o.History[len(o.History)-1].ID
+	return &id
+}
+
+// RewindTo truncates the history to just before the given message so a new
+// sibling can be generated in its place. It returns the removed message.
+func (o *Orchestrator) RewindTo(messageID string) (database.Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, m := range o.History {
+		if m.ID == messageID {
+			o.History = o.History[:i:i]
+			return m, true
+		}
+	}
+	return database.Message{}, false
+}
+
+// SetPinned updates the pinned flag of a message already in the history.
+func (o *Orchestrator) SetPinned(messageID string, pinned bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := range o.History {
+		if o.History[i].ID == messageID {
+			o.History[i].Pinned = pinned
+			return
+		}
+	}
+}
+
 func SerializeMessage(msg StreamMessage) ([]byte, error) {
 	return json.Marshal(msg)
 }
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"localai/database"
+)
+
+func TestInterruptWaitsForRunningGeneration(t *testing.T) {
+	o := NewOrchestrator("s", nil, 0)
+	end := o.Begin()
+	ctx := o.Context()
+
+	finished := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		close(finished)
+		end()
+	}()
+
+	endInterrupt := o.Interrupt()
+	defer endInterrupt()
+
+	select {
+	case <-finished:
+	default:
+		t.Fatal("Interrupt returned before the running generation ended")
+	}
+	if o.IsStopped() {
+		t.Error("orchestrator is still stopped after Interrupt")
+	}
+	if o.Context().Err() != nil {
+		t.Error("Interrupt did not start a fresh context")
+	}
+}
+
+func TestBlindVoteShowsAnswers(t *testing.T) {
+	a := database.ModelConfig{ShortID: "a", Name: "A"}
+	b := database.ModelConfig{ShortID: "b", Name: "B"}
+	o := NewOrchestrator("s", []database.ModelConfig{a, b}, 0)
+
+	reply := func(model database.ModelConfig, kind, content string) database.Message {
+		return database.Message{Role: model.ShortID, ModelID: &model.ShortID, ModelName: &model.Name, Kind: kind, Content: content}
+	}
+	o.LoadHistory([]database.Message{
+		{Role: "user", Content: "question"},
+		reply(a, database.MessageKindAnswer, "answer from a"),
+		reply(b, database.MessageKindAnswer, "answer from b"),
+		reply(b, database.MessageKindVote, "vote from b"),
+	})
+
+	transcript := func() string {
+		var sb strings.Builder
+		for _, e := range o.historyEntries(a, false) {
+			sb.WriteString(e.message.Content)
+			sb.WriteString("\n")
+		}
+		return sb.String()
+	}
+
+	o.SetBlind(database.MessageKindVote)
+	got := transcript()
+	if !strings.Contains(got, "answer from b") {
+		t.Errorf("voter cannot see the other answers:\n%s", got)
+	}
+	if strings.Contains(got, "vote from b") {
+		t.Errorf("voter can see another model's vote:\n%s", got)
+	}
+
+	o.SetBlind(database.MessageKindAnswer)
+	if got := transcript(); strings.Contains(got, "answer from b") || !strings.Contains(got, "answer from a") {
+		t.Errorf("blind answers should only show the model's own answer:\n%s", got)
+	}
+
+	o.SetBlind()
+	if got := transcript(); !strings.Contains(got, "vote from b") {
+		t.Errorf("votes still hidden after SetBlind():\n%s", got)
+	}
+}
+
+func TestSystemPromptMentionsToolsOnlyWhenAvailable(t *testing.T) {
+	RegisterBuiltinTools()
+	o := NewOrchestrator("s", nil, 0)
+
+	plain := o.BuildSystemPrompt(database.ModelConfig{Name: "Plain"})
+	if !strings.Contains(plain, "executing code") || strings.Contains(plain, "## Tools") {
+		t.Errorf("prompt without tools:\n%s", plain)
+	}
+
+	withTools := o.BuildSystemPrompt(database.ModelConfig{Name: "Tooled", Tools: []string{"calculator"}})
+	if strings.Contains(withTools, "executing code") || strings.Contains(withTools, "text-based assistant") {
+		t.Errorf("prompt with tools still disclaims capabilities:\n%s", withTools)
+	}
+	if !strings.Contains(withTools, "- calculator:") {
+		t.Errorf("prompt with tools does not list them:\n%s", withTools)
+	}
+}
+
+func TestUpdateConfigWaitsForRunningGeneration(t *testing.T) {
+	o := NewOrchestrator("s", nil, 0)
+	end := o.Begin()
+
+	o.UpdateConfig(SessionConfig{Name: "Renamed", AutonomyRounds: 2})
+	if o.SessionName != "" || o.AutonomyRounds != 0 {
+		t.Fatal("settings changed while a generation was running")
+	}
+
+	end()
+	if o.SessionName != "Renamed" || o.AutonomyRounds != 2 {
+		t.Errorf("settings not applied once the generation ended: %q %d", o.SessionName, o.AutonomyRounds)
+	}
+
+	o.UpdateConfig(SessionConfig{Name: "Idle"})
+	if o.SessionName != "Idle" {
+		t.Errorf("settings not applied while idle: %q", o.SessionName)
+	}
+}
+
+func TestBeginClearsEarlierStop(t *testing.T) {
+	o := NewOrchestrator("s", nil, 0)
+	o.Stop()
+
+	end := o.Begin()
+	defer end()
+	if o.IsStopped() {
+		t.Error("Begin left the earlier stop in place")
+	}
+	if o.Context().Err() != nil {
+		t.Error("Begin kept the cancelled context")
+	}
+
+	// A second generation shares the live context, so Stop reaches both
+	ctx := o.Context()
+	endSecond := o.Begin()
+	defer endSecond()
+	o.Stop()
+	if ctx.Err() == nil || o.Context().Err() == nil {
+		t.Error("Stop did not cancel every running generation")
+	}
+}
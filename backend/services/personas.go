@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"localai/database"
+)
+
+var promptVariable = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// ResolvePersonas fills in what each model leaves empty from the persona it
+// references: system prompt, role, color and generation parameters. Models
+// still without a role are general.
+func ResolvePersonas(configs []database.ModelConfig) []database.ModelConfig {
+	resolved := make([]database.ModelConfig, len(configs))
+	for i, c := range configs {
+		if c.PersonaID != "" {
+			if p, err := database.GetPersona(c.PersonaID); err == nil {
+				c = applyPersona(c, *p)
+			}
+		}
+		if c.Role == "" {
+			c.Role = database.RoleGeneral
+		}
+		resolved[i] = c
+	}
+	return resolved
+}
+
+func applyPersona(c database.ModelConfig, p database.Persona) database.ModelConfig {
+	if c.SystemPrompt == "" {
+		c.SystemPrompt = p.Prompt
+	}
+	if c.Role == "" {
+		c.Role = p.Role
+	}
+	if c.Color == "" {
+		c.Color = p.Color
+	}
+
+	params, defaults := &c.Params, p.Params
+	if params.Temperature == nil {
+		params.Temperature = defaults.Temperature
+	}
+	if params.TopP == nil {
+		params.TopP = defaults.TopP
+	}
+	if params.TopK == 0 {
+		params.TopK = defaults.TopK
+	}
+	if params.MaxTokens == 0 {
+		params.MaxTokens = defaults.MaxTokens
+	}
+	if len(params.Stop) == 0 {
+		params.Stop = defaults.Stop
+	}
+	if params.Seed == nil {
+		params.Seed = defaults.Seed
+	}
+	if params.ContextSize == 0 {
+		params.ContextSize = defaults.ContextSize
+	}
+	return c
+}
+
+// renderPrompt fills in the template variables of a system prompt:
+// {{date}}, {{session_name}}, {{participants}}, {{documents}}, {{name}} and
+// {{role}}. Unknown variables are left as written.
+func (o *Orchestrator) renderPrompt(prompt string, forModel database.ModelConfig) string {
+	if !strings.Contains(prompt, "{{") {
+		return prompt
+	}
+	return promptVariable.ReplaceAllStringFunc(prompt, func(match string) string {
+		switch promptVariable.FindStringSubmatch(match)[1] {
+		case "date":
+			return time.Now().Format("Monday, January 2, 2006")
+		case "session_name":
+			return o.SessionName
+		case "participants":
+			var participants []string
+			for _, c := range o.ModelConfigs {
+				participants = append(participants, fmt.Sprintf("%s (@%s, %s)", c.Name, c.ShortID, c.Role))
+			}
+			return strings.Join(participants, ", ")
+		case "documents":
+			docs, _ := database.ListDocuments(o.SessionID)
+			if len(docs) == 0 {
+				return "none"
+			}
+			titles := make([]string, len(docs))
+			for i, d := range docs {
+				titles[i] = d.FileName
+			}
+			return strings.Join(titles, ", ")
+		case "name":
+			return forModel.Name
+		case "role":
+			return forModel.Role
+		}
+		return match
+	})
+}
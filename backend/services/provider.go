@@ -3,26 +3,88 @@ package services
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
+
+	"localai/database"
 )
 
 type Provider interface {
 	Name() string
-	StreamChat(ctx context.Context, model string, messages []ChatMessage, onChunk func(string, bool, int)) error
+	StreamChat(ctx context.Context, model string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error)
 	ListModels() ([]Model, error)
 	SupportsModel(modelID string) bool
 }
 
+// Embedder is implemented by providers that can turn text into vectors.
+type Embedder interface {
+	Embed(ctx context.Context, model string, texts []string) ([][]float32, error)
+}
+
+// ChatMessage is the provider-neutral message format. Assistant messages may
+// carry ToolCalls; role "tool" messages answer one of them via ToolCallID.
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string        `json:"role"`
+	Content    string        `json:"content"`
+	Parts      []ContentPart `json:"parts,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+	ToolName   string        `json:"tool_name,omitempty"`
+}
+
+// ContentPart is one piece of a multimodal message: either text or an image
+// given as base64 data with its MIME type.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mime_type,omitempty"`
+	Data     string `json:"data,omitempty"`
+}
+
+// ContentParts returns the message as parts. When Parts is empty the plain
+// Content is wrapped in a single text part.
+func (m ChatMessage) ContentParts() []ContentPart {
+	if len(m.Parts) > 0 {
+		return m.Parts
+	}
+	return []ContentPart{{Type: "text", Text: m.Content}}
+}
+
+// TextContent returns only the text of the message.
+func (m ChatMessage) TextContent() string {
+	if len(m.Parts) == 0 {
+		return m.Content
+	}
+	var texts []string
+	for _, p := range m.Parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+func (m ChatMessage) HasImages() bool {
+	for _, p := range m.Parts {
+		if p.Type == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+type ChatOptions struct {
+	Params database.GenerationParams
+	Tools  []ToolDefinition
 }
 
 type Model struct {
-	ID         string `json:"id"`
-	Name       string `json:"name"`
-	Provider   string `json:"provider"`
-	Size       int64  `json:"size,omitempty"`
-	ModifiedAt string `json:"modified_at,omitempty"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Provider      string `json:"provider"`
+	Size          int64  `json:"size,omitempty"`
+	ModifiedAt    string `json:"modified_at,omitempty"`
+	ContextWindow int    `json:"context_window,omitempty"`
 }
 
 type ProviderConfig struct {
@@ -33,6 +95,7 @@ type ProviderConfig struct {
 
 type ProviderRegistry struct {
 	providers map[string]Provider
+	mu        sync.RWMutex
 }
 
 func NewProviderRegistry() *ProviderRegistry {
@@ -42,19 +105,27 @@ func NewProviderRegistry() *ProviderRegistry {
 }
 
 func (r *ProviderRegistry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.providers[p.Name()] = p
 }
 
 func (r *ProviderRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	delete(r.providers, name)
 }
 
 func (r *ProviderRegistry) Get(name string) Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.providers[name]
 }
 
+// GetForModel returns a provider that serves the model. SupportsModel is
+// asked outside the lock, since some providers look their models up remotely.
 func (r *ProviderRegistry) GetForModel(modelID string) Provider {
-	for _, p := range r.providers {
+	for _, p := range r.ListAll() {
 		if p.SupportsModel(modelID) {
 			return p
 		}
@@ -63,6 +134,8 @@ func (r *ProviderRegistry) GetForModel(modelID string) Provider {
 }
 
 func (r *ProviderRegistry) ListAll() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	result := make([]Provider, 0, len(r.providers))
 	for _, p := range r.providers {
 		result = append(result, p)
@@ -72,12 +145,12 @@ func (r *ProviderRegistry) ListAll() []Provider {
 
 var Providers = NewProviderRegistry()
 
-func StreamChatToProvider(ctx context.Context, modelID string, messages []ChatMessage, onChunk func(string, bool, int)) error {
+func StreamChatToProvider(ctx context.Context, modelID string, messages []ChatMessage, opts ChatOptions, onChunk func(string, bool, int)) ([]ToolCall, error) {
 	provider := Providers.GetForModel(modelID)
 	if provider == nil {
-		return fmt.Errorf("no provider found for model: %s", modelID)
+		return nil, fmt.Errorf("no provider found for model: %s", modelID)
 	}
-	return provider.StreamChat(ctx, modelID, messages, onChunk)
+	return provider.StreamChat(ctx, modelID, messages, opts, onChunk)
 }
 
 func ListAllModels() ([]Model, error) {
@@ -87,6 +160,9 @@ func ListAllModels() ([]Model, error) {
 		if err != nil {
 			continue
 		}
+		for i := range models {
+			models[i].ContextWindow = DefaultContextWindow(models[i].ID)
+		}
 		allModels = append(allModels, models...)
 	}
 	return allModels, nil
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"localai/database"
+)
+
+// DefaultEmbeddingModel is used to index documents when no model is given.
+const DefaultEmbeddingModel = "nomic-embed-text"
+
+const (
+	chunkSize     = 1200
+	chunkOverlap  = 200
+	retrievalTopK = 4
+	minRelevance  = 0.25
+)
+
+var pageMarker = regexp.MustCompile(`(?m)^--- Page (\d+) ---$`)
+
+type TextChunk struct {
+	Content string
+	Page    int
+}
+
+// ChunkDocument splits parsed document text into overlapping chunks of about
+// chunkSize characters, breaking on paragraphs where possible. Pages come
+// from the "--- Page N ---" markers written by the PDF parser.
+func ChunkDocument(content string) []TextChunk {
+	type section struct {
+		page int
+		text string
+	}
+
+	var sections []section
+	markers := pageMarker.FindAllStringSubmatchIndex(content, -1)
+	if len(markers) == 0 {
+		sections = append(sections, section{text: content})
+	} else {
+		if pre := content[:markers[0][0]]; strings.TrimSpace(pre) != "" {
+			sections = append(sections, section{text: pre})
+		}
+		for i, m := range markers {
+			page, _ := strconv.Atoi(content[m[2]:m[3]])
+			end := len(content)
+			if i+1 < len(markers) {
+				end = markers[i+1][0]
+			}
+			sections = append(sections, section{page: page, text: content[m[1]:end]})
+		}
+	}
+
+	var chunks []TextChunk
+	for _, s := range sections {
+		var current strings.Builder
+		pending := false
+		emit := func() {
+			text := strings.TrimSpace(current.String())
+			chunks = append(chunks, TextChunk{Content: text, Page: s.page})
+			current.Reset()
+			pending = false
+
+			// Start the next chunk with the tail of this one for context
+			if len(text) > chunkOverlap {
+				tail := text[len(text)-chunkOverlap:]
+				if i := strings.IndexAny(tail, " \n"); i >= 0 {
+					current.WriteString(tail[i+1:])
+					current.WriteString("\n\n")
+				}
+			}
+		}
+
+		for _, para := range splitParagraphs(s.text) {
+			if pending && current.Len()+len(para) > chunkSize {
+				emit()
+			}
+			current.WriteString(para)
+			current.WriteString("\n\n")
+			pending = true
+		}
+		if pending {
+			emit()
+		}
+	}
+	return chunks
+}
+
+// splitParagraphs splits text on blank lines, further breaking paragraphs
+// longer than chunkSize at word boundaries.
+func splitParagraphs(text string) []string {
+	var result []string
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		for len(para) > chunkSize {
+			cut := strings.LastIndexAny(para[:chunkSize], " \n")
+			if cut <= 0 {
+				cut = chunkSize
+				for cut > 0 && !utf8.RuneStart(para[cut]) {
+					cut--
+				}
+			}
+			result = append(result, para[:cut])
+			para = strings.TrimSpace(para[cut:])
+		}
+		if para != "" {
+			result = append(result, para)
+		}
+	}
+	return result
+}
+
+// IndexDocument chunks and embeds parsed document text and stores it in the
+// session's document store.
+func IndexDocument(ctx context.Context, sessionID string, parsed *DocumentParseResult, embeddingModel string) (*database.Document, error) {
+	if embeddingModel == "" {
+		embeddingModel = DefaultEmbeddingModel
+	}
+
+	chunks := ChunkDocument(parsed.Content)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("document has no text to index")
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Content
+	}
+	vectors, err := Embed(ctx, embeddingModel, texts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed document: %w", err)
+	}
+
+	doc := database.Document{
+		ID:             uuid.New().String(),
+		SessionID:      sessionID,
+		FileName:       parsed.FileName,
+		FileType:       parsed.FileType,
+		Pages:          parsed.Pages,
+		EmbeddingModel: embeddingModel,
+		ChunkCount:     len(chunks),
+		CreatedAt:      time.Now(),
+	}
+	stored := make([]database.DocumentChunk, len(chunks))
+	for i, c := range chunks {
+		stored[i] = database.DocumentChunk{
+			Index:     i,
+			Page:      c.Page,
+			Content:   c.Content,
+			Embedding: vectors[i],
+		}
+	}
+
+	if err := database.SaveDocument(doc, stored); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+type RetrievedChunk struct {
+	database.DocumentChunk
+	Score float64 `json:"score"`
+}
+
+// RetrieveChunks returns the chunks of a session's documents most similar to
+// the query. Documents indexed with different embedding models are each
+// searched with a query vector from their own model.
+func RetrieveChunks(ctx context.Context, sessionID, query string, k int) ([]RetrievedChunk, error) {
+	chunks, err := database.ListSessionChunks(sessionID)
+	if err != nil || len(chunks) == 0 {
+		return nil, err
+	}
+
+	queryVectors := make(map[string][]float32)
+	var results []RetrievedChunk
+	for _, c := range chunks {
+		qv, ok := queryVectors[c.EmbeddingModel]
+		if !ok {
+			vectors, err := Embed(ctx, c.EmbeddingModel, []string{query})
+			if err != nil {
+				return nil, err
+			}
+			qv = vectors[0]
+			queryVectors[c.EmbeddingModel] = qv
+		}
+
+		score := cosineSimilarity(qv, c.Embedding)
+		if score >= minRelevance {
+			results = append(results, RetrievedChunk{DocumentChunk: c, Score: score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Citation formats the source of a chunk, e.g. "report.pdf, page 3".
+func (c RetrievedChunk) Citation() string {
+	if c.Page > 0 {
+		return fmt.Sprintf("%s, page %d", c.FileName, c.Page)
+	}
+	return c.FileName
+}
+
+// FormatRetrievedContext renders retrieved chunks as a system prompt section
+// with numbered sources the model can cite.
+func FormatRetrievedContext(chunks []RetrievedChunk) string {
+	if len(chunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\n\n## Document Excerpts\n")
+	sb.WriteString("These excerpts from documents attached to this chat may help answer the latest message. ")
+	sb.WriteString("Cite them as [1], [2], ... when you use them, and say so if they do not contain the answer.\n")
+	for i, c := range chunks {
+		sb.WriteString(fmt.Sprintf("\n[%d] %s\n%s\n", i+1, c.Citation(), c.Content))
+	}
+	return sb.String()
+}
+
+type cachedRetrieval struct {
+	query string
+	text  string
+}
+
+// retrievalContext looks up document excerpts for the query, reusing the
+// previous lookup when several models answer the same message.
+func (o *Orchestrator) retrievalContext(query string) string {
+	if strings.TrimSpace(query) == "" {
+		return ""
+	}
+
+	o.mu.Lock()
+	cached := o.retrieval
+	o.mu.Unlock()
+	if cached != nil && cached.query == query {
+		return cached.text
+	}
+
+	chunks, err := RetrieveChunks(o.Context(), o.SessionID, query, retrievalTopK)
+	if err != nil {
+		log.Printf("Document retrieval failed for session %s: %v", o.SessionID, err)
+		return ""
+	}
+	text := FormatRetrievedContext(chunks)
+
+	o.mu.Lock()
+	o.retrieval = &cachedRetrieval{query: query, text: text}
+	o.mu.Unlock()
+	return text
+}
+
+// InvalidateRetrieval drops cached document excerpts after the session's
+// documents change.
+func (o *Orchestrator) InvalidateRetrieval() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.retrieval = nil
+}
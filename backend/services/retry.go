@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"localai/database"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// RetryPolicyFor applies a model's retry overrides on top of the default policy.
+func RetryPolicyFor(config *database.RetryConfig) RetryPolicy {
+	policy := DefaultRetryPolicy
+	if config == nil {
+		return policy
+	}
+	if config.MaxAttempts > 0 {
+		policy.MaxAttempts = config.MaxAttempts
+	}
+	if config.BaseDelayMs > 0 {
+		policy.BaseDelay = time.Duration(config.BaseDelayMs) * time.Millisecond
+	}
+	if config.MaxDelayMs > 0 {
+		policy.MaxDelay = time.Duration(config.MaxDelayMs) * time.Millisecond
+	}
+	return policy
+}
+
+// delay returns the wait before the given retry (1-based), doubling each time
+// with a little jitter. A server-provided Retry-After takes precedence.
+func (p RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	d += time.Duration(rand.Int63n(int64(d)/4 + 1))
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// StreamChatWithRetry calls StreamChatToProvider and retries rate-limit and
+// transient failures with exponential backoff. Retries only happen while no
+// output has been streamed, so callers never see duplicated text. onRetry is
+// called before each wait.
+func StreamChatWithRetry(ctx context.Context, modelID string, messages []ChatMessage, opts ChatOptions, policy RetryPolicy, onChunk func(string, bool, int), onRetry func(attempt int, wait time.Duration, err error)) ([]ToolCall, error) {
+	for attempt := 1; ; attempt++ {
+		streamed := false
+		toolCalls, err := StreamChatToProvider(ctx, modelID, messages, opts, func(chunk string, done bool, tokens int) {
+			if chunk != "" {
+				streamed = true
+			}
+			onChunk(chunk, done, tokens)
+		})
+		if err == nil || streamed || ctx.Err() != nil || attempt >= policy.MaxAttempts {
+			return toolCalls, err
+		}
+
+		pe, ok := AsProviderError(err)
+		if !ok || !pe.Retryable() {
+			return toolCalls, err
+		}
+
+		if pe.RetryAfter > policy.MaxDelay {
+			// The server asked us to wait longer than we are willing to
+			return toolCalls, err
+		}
+		wait := policy.delay(attempt, pe.RetryAfter)
+
+		if onRetry != nil {
+			onRetry(attempt, wait, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"sync"
+
+	"localai/database"
+)
+
+// builtinRoles are always available. Their keywords drive keyword routing
+// alongside those of custom roles.
+var builtinRoles = []database.Role{
+	{
+		Name:        database.RolePlanner,
+		Description: "Plans, designs and weighs approaches before work starts",
+		Keywords: []string{
+			"plan", "planning", "brainstorm", "ideas", "think about",
+			"design", "architect", "architecture", "strategy", "approach", "outline",
+			"what should", "how should", "let's discuss", "think through",
+			"consider", "propose", "suggest", "recommendation",
+		},
+	},
+	{
+		Name:        database.RoleCoder,
+		Description: "Writes, fixes and refactors code",
+		Keywords: []string{
+			"code", "coding", "implement", "write a function", "write code",
+			"function", "class", "method", "api", "endpoint", "database", "sql",
+			"fix bug", "fix the bug", "debug", "refactor", "program", "script",
+			"html", "css", "javascript", "typescript", "python", "golang", "rust", "swift", "react",
+			"compile", "compiler", "stack trace",
+		},
+	},
+	{
+		Name:        database.RoleReviewer,
+		Description: "Reviews work and points out problems and improvements",
+		Keywords: []string{
+			"review", "check", "analyze", "evaluate", "assess",
+			"feedback", "improve", "optimize", "critique", "look at",
+			"what's wrong", "find issues", "bugs in",
+		},
+	},
+	{
+		Name:        database.RoleGeneral,
+		Description: "Handles anything that needs no specialist",
+	},
+}
+
+var (
+	customRoles     = make(map[string]database.Role)
+	rolePatterns    = make(map[string][]*regexp.Regexp)
+	customRolesMu   sync.RWMutex
+	builtinPatterns = func() map[string][]*regexp.Regexp {
+		patterns := make(map[string][]*regexp.Regexp)
+		for _, r := range builtinRoles {
+			patterns[r.Name] = keywordPatterns(r.Keywords)
+		}
+		return patterns
+	}()
+)
+
+// keywordPatterns matches keywords as whole words, so "go" does not match
+// "good".
+func keywordPatterns(keywords []string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, kw := range keywords {
+		if kw == "" {
+			continue
+		}
+		patterns = append(patterns, regexp.MustCompile(`(?i)(^|\W)`+regexp.QuoteMeta(kw)+`($|\W)`))
+	}
+	return patterns
+}
+
+func IsBuiltinRole(name string) bool {
+	for _, r := range builtinRoles {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func SetCustomRole(r database.Role) {
+	customRolesMu.Lock()
+	defer customRolesMu.Unlock()
+	customRoles[r.Name] = r
+	rolePatterns[r.Name] = keywordPatterns(r.Keywords)
+}
+
+func RemoveCustomRole(name string) {
+	customRolesMu.Lock()
+	defer customRolesMu.Unlock()
+	delete(customRoles, name)
+	delete(rolePatterns, name)
+}
+
+// Roles returns the built-in roles followed by the custom roles by name.
+func Roles() []database.Role {
+	customRolesMu.RLock()
+	defer customRolesMu.RUnlock()
+
+	roles := append([]database.Role(nil), builtinRoles...)
+	start := len(roles)
+	for _, r := range customRoles {
+		roles = append(roles, r)
+	}
+	sort.Slice(roles[start:], func(i, j int) bool {
+		return roles[start+i].Name < roles[start+j].Name
+	})
+	return roles
+}
+
+func LookupRole(name string) (database.Role, bool) {
+	for _, r := range builtinRoles {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	customRolesMu.RLock()
+	defer customRolesMu.RUnlock()
+	r, ok := customRoles[name]
+	return r, ok
+}
+
+// roleKeywordPatterns returns the compiled routing hints of a role.
+func roleKeywordPatterns(name string) []*regexp.Regexp {
+	if patterns, ok := builtinPatterns[name]; ok {
+		return patterns
+	}
+	customRolesMu.RLock()
+	defer customRolesMu.RUnlock()
+	return rolePatterns[name]
+}
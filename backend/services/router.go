@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"localai/database"
+)
+
+// defaultRouterConfidence is the confidence a model router's decision needs
+// when the session does not set one.
+const defaultRouterConfidence = 0.6
+
+// TaskRouter picks the models that answer a user message nobody was
+// mentioned in.
+type TaskRouter interface {
+	Route(ctx context.Context, content string, models []database.ModelConfig) (database.RoutingDecision, error)
+}
+
+// NewTaskRouter returns the router a session is configured with.
+func NewTaskRouter(config database.RouterConfig) TaskRouter {
+	if config.Mode == database.RouterModel && config.Model != "" {
+		return &ModelRouter{
+			ModelID:       config.Model,
+			MinConfidence: config.MinConfidence,
+			Fallback:      KeywordRouter{},
+		}
+	}
+	return KeywordRouter{}
+}
+
+// scoreTask counts the routing hints of each role found in content, in the
+// order of Roles.
+func scoreTask(content string) ([]string, map[string]int) {
+	var roles []string
+	scores := make(map[string]int)
+	for _, r := range Roles() {
+		if r.Name == database.RoleGeneral {
+			continue
+		}
+		roles = append(roles, r.Name)
+		for _, p := range roleKeywordPatterns(r.Name) {
+			if p.MatchString(content) {
+				scores[r.Name]++
+			}
+		}
+	}
+	return roles, scores
+}
+
+// ClassifyTask returns the role whose routing hints occur most often in content,
+// or the general role when none clearly wins.
+func ClassifyTask(content string) string {
+	role, _ := classifyTask(content)
+	return role
+}
+
+// classifyTask is ClassifyTask with the share of matched keywords that
+// belonged to the winning role.
+func classifyTask(content string) (string, float64) {
+	roles, scores := scoreTask(content)
+	total, best, winner := 0, 0, database.RoleGeneral
+	tied := false
+	for _, role := range roles {
+		total += scores[role]
+		switch {
+		case scores[role] > best:
+			best, winner, tied = scores[role], role, false
+		case scores[role] == best && best > 0:
+			tied = true
+		}
+	}
+	if total == 0 || tied {
+		return database.RoleGeneral, 0
+	}
+	return winner, float64(best) / float64(total)
+}
+
+// KeywordRouter routes by counting role keywords and sends the message to
+// the first model with the winning role.
+type KeywordRouter struct{}
+
+func (KeywordRouter) Route(ctx context.Context, content string, models []database.ModelConfig) (database.RoutingDecision, error) {
+	role, confidence := classifyTask(content)
+	decision := database.RoutingDecision{
+		Router:     database.RouterKeyword,
+		Roles:      []string{role},
+		Confidence: confidence,
+	}
+	if len(models) == 0 {
+		return decision, fmt.Errorf("no models to route to")
+	}
+
+	responder := modelForRole(models, role)
+	decision.Responders = []string{responder.ShortID}
+	if role == database.RoleGeneral {
+		decision.Reason = "No role keywords stood out"
+	} else {
+		decision.Reason = fmt.Sprintf("The message reads like a %s task", role)
+	}
+	return decision, nil
+}
+
+// modelForRole returns the first model with role, else the first general
+// model, else the first model.
+func modelForRole(models []database.ModelConfig, role string) database.ModelConfig {
+	for _, c := range models {
+		if c.Role == role {
+			return c
+		}
+	}
+	for _, c := range models {
+		if c.Role == database.RoleGeneral {
+			return c
+		}
+	}
+	return models[0]
+}
+
+// ModelRouter asks a small model to classify the message and pick the
+// responders. Decisions it cannot make, or makes with less than
+// MinConfidence, are left to Fallback.
+type ModelRouter struct {
+	ModelID       string
+	MinConfidence float64
+	Fallback      TaskRouter
+}
+
+func (r *ModelRouter) Route(ctx context.Context, content string, models []database.ModelConfig) (database.RoutingDecision, error) {
+	decision, err := r.ask(ctx, content, models)
+	if err == nil {
+		minConfidence := r.MinConfidence
+		if minConfidence <= 0 {
+			minConfidence = defaultRouterConfidence
+		}
+		if decision.Confidence >= minConfidence {
+			return decision, nil
+		}
+		err = fmt.Errorf("confidence %.2f is below %.2f", decision.Confidence, minConfidence)
+	}
+	if r.Fallback == nil {
+		return decision, err
+	}
+
+	fallback, fallbackErr := r.Fallback.Route(ctx, content, models)
+	if fallbackErr != nil {
+		return fallback, fallbackErr
+	}
+	fallback.Fallback = true
+	fallback.Reason = fmt.Sprintf("%s (router model %s not used: %v)", fallback.Reason, r.ModelID, err)
+	return fallback, nil
+}
+
+func (r *ModelRouter) ask(ctx context.Context, content string, models []database.ModelConfig) (database.RoutingDecision, error) {
+	if len(models) == 0 {
+		return database.RoutingDecision{}, fmt.Errorf("no models to route to")
+	}
+
+	var roles, participants strings.Builder
+	for _, r := range Roles() {
+		roles.WriteString(fmt.Sprintf("- %s: %s\n", r.Name, r.Description))
+	}
+	for _, c := range models {
+		participants.WriteString(fmt.Sprintf("- %s: %s (%s)\n", c.ShortID, c.Name, c.Role))
+	}
+	system := "You route a user's message to the AI assistants best suited to answer it. Classify the request into one or more of the roles below " +
+		"and pick the assistants that should respond, usually just one.\n\nRoles:\n" + roles.String() + "\nAssistants:\n" + participants.String() +
+		"\nReply with JSON only, for example {\"roles\": [\"coder\"], \"responders\": [\"<assistant id>\"], \"confidence\": 0.8, \"reason\": \"<one short sentence>\"}. " +
+		"confidence is between 0 and 1 and says how sure you are of the choice."
+
+	var answer struct {
+		Roles      []string `json:"roles"`
+		Responders []string `json:"responders"`
+		Confidence float64  `json:"confidence"`
+		Reason     string   `json:"reason"`
+	}
+	if err := askForJSON(ctx, r.ModelID, system, content, &answer); err != nil {
+		return database.RoutingDecision{}, err
+	}
+
+	decision := database.RoutingDecision{
+		Router:     database.RouterModel,
+		Roles:      answer.Roles,
+		Confidence: answer.Confidence,
+		Reason:     answer.Reason,
+	}
+	for _, id := range answer.Responders {
+		id = strings.TrimPrefix(strings.TrimSpace(id), "@")
+		for _, c := range models {
+			if (strings.EqualFold(c.ShortID, id) || strings.EqualFold(c.Name, id)) && !containsString(decision.Responders, c.ShortID) {
+				decision.Responders = append(decision.Responders, c.ShortID)
+				break
+			}
+		}
+	}
+	if len(decision.Responders) == 0 {
+		for _, role := range answer.Roles {
+			for _, c := range models {
+				if strings.EqualFold(c.Role, role) {
+					decision.Responders = append(decision.Responders, c.ShortID)
+					break
+				}
+			}
+		}
+	}
+	if len(decision.Responders) == 0 {
+		return decision, fmt.Errorf("router chose no known assistant: %v", answer.Responders)
+	}
+	return decision, nil
+}
+
+// askForJSON sends a system and user message to modelID and decodes the JSON
+// object in its reply into v.
+func askForJSON(ctx context.Context, modelID, system, user string, v interface{}) error {
+	messages := []ChatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: user},
+	}
+	temperature := 0.0
+	opts := ChatOptions{Params: database.GenerationParams{Temperature: &temperature, MaxTokens: 200}}
+
+	var sb strings.Builder
+	_, err := StreamChatToProvider(ctx, modelID, messages, opts, func(chunk string, done bool, tokens int) {
+		sb.WriteString(chunk)
+	})
+	if err != nil {
+		return err
+	}
+
+	reply := sb.String()
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("%s did not reply with JSON: %q", modelID, reply)
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), v); err != nil {
+		return fmt.Errorf("invalid reply from %s: %w", modelID, err)
+	}
+	return nil
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
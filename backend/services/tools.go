@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+type ToolDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type ToolHandler func(ctx context.Context, args json.RawMessage) (string, error)
+
+type Tool struct {
+	Definition ToolDefinition
+	Handler    ToolHandler
+}
+
+type ToolRegistry struct {
+	tools map[string]Tool
+	mu    sync.RWMutex
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{
+		tools: make(map[string]Tool),
+	}
+}
+
+func (r *ToolRegistry) Register(t Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[t.Definition.Name] = t
+}
+
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+func (r *ToolRegistry) ListAll() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make([]ToolDefinition, 0, len(r.tools))
+	for _, t := range r.tools {
+		result = append(result, t.Definition)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Definitions returns the definitions for the named tools, skipping unknown names.
+func (r *ToolRegistry) Definitions(names []string) []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var result []ToolDefinition
+	for _, name := range names {
+		if t, ok := r.tools[name]; ok {
+			result = append(result, t.Definition)
+		}
+	}
+	return result
+}
+
+// Execute runs a tool call and returns the text handed back to the model.
+// Failures are reported as text so the model can recover from them.
+func (r *ToolRegistry) Execute(ctx context.Context, call ToolCall) (string, bool) {
+	t, ok := r.Get(call.Name)
+	if !ok {
+		return fmt.Sprintf("Error: unknown tool %q", call.Name), false
+	}
+
+	args := call.Arguments
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	result, err := t.Handler(ctx, args)
+	if err != nil {
+		return "Error: " + err.Error(), false
+	}
+	return result, true
+}
+
+var Tools = NewToolRegistry()
+
+func RegisterBuiltinTools() {
+	Tools.Register(Tool{
+		Definition: ToolDefinition{
+			Name:        "current_time",
+			Description: "Get the current date and time, optionally in a specific IANA timezone such as Europe/Berlin.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"timezone":{"type":"string","description":"IANA timezone name"}}}`),
+		},
+		Handler: currentTimeTool,
+	})
+
+	Tools.Register(Tool{
+		Definition: ToolDefinition{
+			Name:        "calculator",
+			Description: "Evaluate an arithmetic expression with + - * / % ^ and parentheses, e.g. (3 + 4) * 2.5.",
+			Parameters:  json.RawMessage(`{"type":"object","properties":{"expression":{"type":"string","description":"The expression to evaluate"}},"required":["expression"]}`),
+		},
+		Handler: calculatorTool,
+	})
+}
+
+func currentTimeTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var req struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	now := time.Now()
+	if req.Timezone != "" {
+		loc, err := time.LoadLocation(req.Timezone)
+		if err != nil {
+			return "", fmt.Errorf("unknown timezone: %s", req.Timezone)
+		}
+		now = now.In(loc)
+	}
+
+	return now.Format("Monday, 2006-01-02 15:04:05 MST"), nil
+}
+
+func calculatorTool(ctx context.Context, args json.RawMessage) (string, error) {
+	var req struct {
+		Expression string `json:"expression"`
+	}
+	if err := json.Unmarshal(args, &req); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	value, err := EvaluateExpression(req.Expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// EvaluateExpression evaluates a basic arithmetic expression.
+func EvaluateExpression(expr string) (float64, error) {
+	p := &exprParser{input: strings.TrimSpace(expr)}
+	if p.input == "" {
+		return 0, fmt.Errorf("empty expression")
+	}
+
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, fmt.Errorf("result is not a finite number")
+	}
+	return value, nil
+}
+
+type exprParser struct {
+	input string
+	pos   int
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseSum() (float64, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return 0, err
+		}
+		if op == '+' {
+			left += right
+		} else {
+			left -= right
+		}
+	}
+}
+
+func (p *exprParser) parseProduct() (float64, error) {
+	left, err := p.parsePower()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' && op != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parsePower()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			left *= right
+		case '/':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			left = math.Mod(left, right)
+		}
+	}
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	base, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	if p.peek() == '^' {
+		p.pos++
+		exp, err := p.parsePower()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(base, exp), nil
+	}
+	return base, nil
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		v, err := p.parseUnary()
+		return -v, err
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	if p.peek() == '(' {
+		p.pos++
+		v, err := p.parseSum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return v, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos < len(p.input) {
+			return 0, fmt.Errorf("unexpected %q at position %d", p.input[p.pos], p.pos)
+		}
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	return strconv.ParseFloat(p.input[start:p.pos], 64)
+}
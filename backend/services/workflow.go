@@ -0,0 +1,282 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"localai/database"
+)
+
+const (
+	defaultApprovalMarker     = "APPROVED"
+	defaultWorkflowIterations = 3
+)
+
+var workflowPlaceholder = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// negatedApproval matches text that ends in a negation, as in "NOT APPROVED".
+var negatedApproval = regexp.MustCompile(`(?i)(\bnot|n't)$`)
+
+// stageDependencies returns the stages each stage waits for. Workflows that
+// declare no dependencies at all run their stages in order.
+func stageDependencies(w database.Workflow) map[string][]string {
+	ordered := true
+	for _, s := range w.Stages {
+		if len(s.DependsOn) > 0 {
+			ordered = false
+			break
+		}
+	}
+
+	deps := make(map[string][]string, len(w.Stages))
+	for i, s := range w.Stages {
+		if ordered && i > 0 {
+			deps[s.ID] = []string{w.Stages[i-1].ID}
+		} else {
+			deps[s.ID] = s.DependsOn
+		}
+	}
+	return deps
+}
+
+// ValidateWorkflow checks that stage IDs are unique, dependencies and
+// placeholders name existing stages, the stages form no cycle, and loops
+// only go back to the stage itself or one it depends on.
+func ValidateWorkflow(w database.Workflow) error {
+	stages := make(map[string]bool, len(w.Stages))
+	for _, s := range w.Stages {
+		if s.ID == "" {
+			return fmt.Errorf("every workflow stage needs an id")
+		}
+		if s.ID == "input" || s.ID == "iteration" {
+			return fmt.Errorf("stage id %q is reserved", s.ID)
+		}
+		if stages[s.ID] {
+			return fmt.Errorf("duplicate stage id: %s", s.ID)
+		}
+		if s.Role == "" && s.ShortID == "" {
+			return fmt.Errorf("stage %s needs a role or short_id", s.ID)
+		}
+		stages[s.ID] = true
+	}
+
+	deps := stageDependencies(w)
+	for _, s := range w.Stages {
+		for _, d := range deps[s.ID] {
+			if !stages[d] {
+				return fmt.Errorf("stage %s depends on unknown stage %s", s.ID, d)
+			}
+		}
+		for _, m := range workflowPlaceholder.FindAllStringSubmatch(s.Prompt, -1) {
+			if name := m[1]; name != "input" && name != "iteration" && !stages[name] {
+				return fmt.Errorf("stage %s references unknown stage {{%s}}", s.ID, name)
+			}
+		}
+	}
+
+	// Kahn's algorithm; anything left unsorted sits on a cycle
+	remaining := make(map[string]int, len(w.Stages))
+	for _, s := range w.Stages {
+		remaining[s.ID] = len(deps[s.ID])
+	}
+	sorted := 0
+	for progress := true; progress; {
+		progress = false
+		for _, s := range w.Stages {
+			if remaining[s.ID] != 0 {
+				continue
+			}
+			remaining[s.ID] = -1
+			sorted++
+			progress = true
+			for _, other := range w.Stages {
+				for _, d := range deps[other.ID] {
+					if d == s.ID {
+						remaining[other.ID]--
+					}
+				}
+			}
+		}
+	}
+	if sorted != len(w.Stages) {
+		return fmt.Errorf("workflow stages depend on each other in a cycle")
+	}
+
+	for _, s := range w.Stages {
+		if s.Loop == nil {
+			continue
+		}
+		if s.Loop.BackTo == "" {
+			return fmt.Errorf("stage %s loops without a back_to stage", s.ID)
+		}
+		if s.Loop.BackTo != s.ID && !dependsOn(deps, s.ID, s.Loop.BackTo) {
+			return fmt.Errorf("stage %s can only loop back to itself or a stage it depends on", s.ID)
+		}
+	}
+	return nil
+}
+
+// dependsOn reports whether stage transitively depends on ancestor.
+func dependsOn(deps map[string][]string, stage, ancestor string) bool {
+	for _, d := range deps[stage] {
+		if d == ancestor || dependsOn(deps, d, ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// WorkflowRun tracks one pass of a workflow over a user message: which
+// stages are done, their latest outputs and how often each stage has run.
+type WorkflowRun struct {
+	Workflow   database.Workflow
+	Input      string
+	Outputs    map[string]string
+	Iterations map[string]int
+	deps       map[string][]string
+	done       map[string]bool
+}
+
+func NewWorkflowRun(w database.Workflow, input string) *WorkflowRun {
+	return &WorkflowRun{
+		Workflow:   w,
+		Input:      input,
+		Outputs:    make(map[string]string),
+		Iterations: make(map[string]int),
+		deps:       stageDependencies(w),
+		done:       make(map[string]bool),
+	}
+}
+
+// Next returns the first stage, in declaration order, that has not run yet
+// and whose dependencies are all done.
+func (r *WorkflowRun) Next() (database.WorkflowStage, bool) {
+	for _, s := range r.Workflow.Stages {
+		if r.done[s.ID] {
+			continue
+		}
+		ready := true
+		for _, d := range r.deps[s.ID] {
+			if !r.done[d] {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return s, true
+		}
+	}
+	return database.WorkflowStage{}, false
+}
+
+// Iteration is the 1-based number of the current pass through a stage.
+func (r *WorkflowRun) Iteration(stage database.WorkflowStage) int {
+	return r.Iterations[stage.ID] + 1
+}
+
+// Complete records a stage's output. When the stage loops and its output
+// does not approve, the loop target and every stage after it are marked to
+// run again and the target is returned. exhausted is set when the loop gave
+// up after its last iteration.
+func (r *WorkflowRun) Complete(stage database.WorkflowStage, output string) (loopTo string, exhausted bool) {
+	r.Outputs[stage.ID] = output
+	r.done[stage.ID] = true
+	r.Iterations[stage.ID]++
+
+	if stage.Loop == nil || approves(output, approvalMarker(stage.Loop)) {
+		return "", false
+	}
+
+	max := stage.Loop.MaxIterations
+	if max <= 0 {
+		max = defaultWorkflowIterations
+	}
+	if r.Iterations[stage.ID] >= max {
+		return "", true
+	}
+
+	for _, s := range r.Workflow.Stages {
+		if s.ID == stage.Loop.BackTo || dependsOn(r.deps, s.ID, stage.Loop.BackTo) {
+			r.done[s.ID] = false
+		}
+	}
+	return stage.Loop.BackTo, false
+}
+
+// Prompt renders a stage's prompt. Looping stages are also told how to
+// approve.
+func (r *WorkflowRun) Prompt(stage database.WorkflowStage) string {
+	prompt := workflowPlaceholder.ReplaceAllStringFunc(stage.Prompt, func(match string) string {
+		name := workflowPlaceholder.FindStringSubmatch(match)[1]
+		switch name {
+		case "input":
+			return r.Input
+		case "iteration":
+			return strconv.Itoa(r.Iteration(stage))
+		}
+		return r.Outputs[name]
+	})
+
+	if stage.Loop != nil {
+		if prompt == "" {
+			prompt = r.Input
+		}
+		prompt += fmt.Sprintf("\n\nIf the work is acceptable as it is, reply with %s. Otherwise explain exactly what must change.", approvalMarker(stage.Loop))
+	}
+	return strings.TrimSpace(prompt)
+}
+
+// StageModel resolves the session model that runs a stage.
+func StageModel(stage database.WorkflowStage, configs []database.ModelConfig) (database.ModelConfig, bool) {
+	for _, c := range configs {
+		if stage.ShortID != "" && strings.EqualFold(c.ShortID, stage.ShortID) {
+			return c, true
+		}
+	}
+	if stage.ShortID != "" {
+		return database.ModelConfig{}, false
+	}
+	for _, c := range configs {
+		if c.Role == stage.Role {
+			return c, true
+		}
+	}
+	return database.ModelConfig{}, false
+}
+
+func approvalMarker(loop *database.WorkflowLoop) string {
+	if loop.Until != "" {
+		return loop.Until
+	}
+	return defaultApprovalMarker
+}
+
+// approves reports whether output contains the marker as a whole word,
+// ignoring occurrences that are negated such as "NOT APPROVED".
+func approves(output, marker string) bool {
+	if marker == "" {
+		return false
+	}
+	pattern := regexp.QuoteMeta(marker)
+	if isWordByte(marker[0]) {
+		pattern = `\b` + pattern
+	}
+	if isWordByte(marker[len(marker)-1]) {
+		pattern += `\b`
+	}
+	re := regexp.MustCompile(`(?i)` + pattern)
+
+	for _, loc := range re.FindAllStringIndex(output, -1) {
+		before := strings.TrimRight(output[:loc[0]], " *_\t")
+		if !negatedApproval.MatchString(before) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"localai/database"
+)
+
+func TestApproves(t *testing.T) {
+	tests := []struct {
+		output string
+		marker string
+		want   bool
+	}{
+		{"APPROVED", "APPROVED", true},
+		{"Looks good. **Approved**", "APPROVED", true},
+		{"approved, ship it", "APPROVED", true},
+		{"NOT APPROVED", "APPROVED", false},
+		{"This isn't approved yet", "APPROVED", false},
+		{"UNAPPROVED", "APPROVED", false},
+		{"DISAPPROVED: the tests fail", "APPROVED", false},
+		{"unapproved changes remain", "APPROVED", false},
+		{"NOT APPROVED before, but now APPROVED", "APPROVED", true},
+		{"I cannot approve this", "APPROVED", false},
+		{"LGTM!", "LGTM!", true},
+		{"[DONE]", "[DONE]", true},
+		{"not [DONE]", "[DONE]", false},
+		{"", "APPROVED", false},
+	}
+	for _, tt := range tests {
+		if got := approves(tt.output, tt.marker); got != tt.want {
+			t.Errorf("approves(%q, %q) = %v, want %v", tt.output, tt.marker, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWorkflow(t *testing.T) {
+	stage := func(id, prompt string, dependsOn ...string) database.WorkflowStage {
+		return database.WorkflowStage{ID: id, Role: "writer", Prompt: prompt, DependsOn: dependsOn}
+	}
+	looping := func(s database.WorkflowStage, backTo string) database.WorkflowStage {
+		s.Loop = &database.WorkflowLoop{BackTo: backTo}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		stages  []database.WorkflowStage
+		wantErr string
+	}{
+		{"sequential", []database.WorkflowStage{stage("draft", "{{input}}"), looping(stage("review", "{{draft}} #{{iteration}}"), "draft")}, ""},
+		{"dag", []database.WorkflowStage{stage("a", ""), stage("b", "", "a"), stage("c", "{{a}} {{b}}", "a", "b")}, ""},
+		{"loop to itself", []database.WorkflowStage{looping(stage("a", ""), "a")}, ""},
+		{"cycle", []database.WorkflowStage{stage("a", "", "b"), stage("b", "", "a")}, "cycle"},
+		{"self dependency", []database.WorkflowStage{stage("a", "", "a")}, "cycle"},
+		{"empty back_to", []database.WorkflowStage{stage("a", ""), looping(stage("b", ""), "")}, "without a back_to"},
+		{"loop forward", []database.WorkflowStage{looping(stage("a", ""), "b"), stage("b", "")}, "loop back"},
+		{"unknown placeholder", []database.WorkflowStage{stage("a", "{{summary}}")}, "unknown stage {{summary}}"},
+		{"unknown dependency", []database.WorkflowStage{stage("a", "", "missing")}, "unknown stage missing"},
+		{"duplicate id", []database.WorkflowStage{stage("a", ""), stage("a", "")}, "duplicate"},
+		{"reserved id", []database.WorkflowStage{stage("input", "")}, "reserved"},
+		{"no model", []database.WorkflowStage{{ID: "a"}}, "role or short_id"},
+	}
+	for _, tt := range tests {
+		err := ValidateWorkflow(database.Workflow{Stages: tt.stages})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		case tt.wantErr != "" && err == nil:
+			t.Errorf("%s: expected an error containing %q", tt.name, tt.wantErr)
+		case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+			t.Errorf("%s: error %q does not contain %q", tt.name, err, tt.wantErr)
+		}
+	}
+}